@@ -0,0 +1,231 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// archiveEntry is a file or directory in an archive.
+type archiveEntry struct {
+	zipHeader *zip.FileHeader // set for zip archives
+	tarHeader *tar.Header     // set for tar archives
+	data      []byte
+}
+
+func (e *archiveEntry) name() string {
+	if e.zipHeader != nil {
+		return e.zipHeader.Name
+	}
+	return e.tarHeader.Name
+}
+
+func (e *archiveEntry) isGoFile() bool {
+	name := e.name()
+	if e.zipHeader != nil && e.zipHeader.FileInfo().IsDir() {
+		return false
+	}
+	if e.tarHeader != nil && e.tarHeader.Typeflag != tar.TypeReg {
+		return false
+	}
+	base := path.Base(name)
+	return !strings.HasPrefix(base, ".") && !strings.HasPrefix(base, "_") && strings.HasSuffix(base, ".go")
+}
+
+// archiveFormat is the format of an archive, determined by its file
+// extension.
+type archiveFormat int
+
+const (
+	formatZip archiveFormat = iota
+	formatTar
+	formatTarGzip
+)
+
+func archiveFormatOf(filename string) (archiveFormat, error) {
+	switch {
+	case strings.HasSuffix(filename, ".zip"):
+		return formatZip, nil
+	case strings.HasSuffix(filename, ".tar"):
+		return formatTar, nil
+	case strings.HasSuffix(filename, ".tar.gz"), strings.HasSuffix(filename, ".tgz"):
+		return formatTarGzip, nil
+	default:
+		return 0, fmt.Errorf("unknown archive format for %s: must be .zip, .tar, .tar.gz, or .tgz", filename)
+	}
+}
+
+// handleArchive processes the Go files in the archive at inPath, without
+// extracting it to disk. It lists the names of the entries that have
+// duplicate imports to out. If outPath is not empty, it also writes an
+// archive of the same format to outPath, with the Go files rewritten and the
+// other entries copied as is.
+func handleArchive(fset *token.FileSet, inPath, outPath string, out io.Writer) {
+	if err := handleArchive_(fset, inPath, outPath, out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		setExitCode(1)
+	}
+}
+
+func handleArchive_(fset *token.FileSet, inPath, outPath string, out io.Writer) error {
+	inFormat, err := archiveFormatOf(inPath)
+	if err != nil {
+		return err
+	}
+	var outFormat archiveFormat
+	if outPath != "" {
+		outFormat, err = archiveFormatOf(outPath)
+		if err != nil {
+			return err
+		}
+		if (outFormat == formatZip) != (inFormat == formatZip) {
+			return fmt.Errorf("cannot convert between zip and tar archives: %s, %s", inPath, outPath)
+		}
+	}
+
+	entries, err := readArchive(inPath, inFormat)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if !e.isGoFile() || !*generated && isGenerated(e.data) {
+			continue
+		}
+		result, err := processFile(fset, e.data, e.name())
+		if err != nil {
+			var buf bytes.Buffer
+			scanner.PrintError(&buf, err)
+			errOut.Write(buf.Bytes())
+			setExitCode(1)
+			continue
+		}
+		if !bytes.Equal(result.Output, e.data) {
+			anyChanged = true
+			fmt.Fprintln(out, e.name())
+			e.data = result.Output
+		}
+	}
+
+	if outPath == "" {
+		return nil
+	}
+	return writeArchive(outPath, outFormat, entries)
+}
+
+func readArchive(filename string, format archiveFormat) ([]*archiveEntry, error) {
+	var entries []*archiveEntry
+
+	if format == formatZip {
+		r, err := zip.OpenReader(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			data, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			h := f.FileHeader
+			entries = append(entries, &archiveEntry{zipHeader: &h, data: data})
+		}
+		return entries, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if format == formatTarGzip {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &archiveEntry{tarHeader: h, data: data})
+	}
+	return entries, nil
+}
+
+func writeArchive(filename string, format archiveFormat, entries []*archiveEntry) error {
+	var buf bytes.Buffer
+
+	if format == formatZip {
+		w := zip.NewWriter(&buf)
+		for _, e := range entries {
+			h := *e.zipHeader
+			h.UncompressedSize64 = uint64(len(e.data))
+			fw, err := w.CreateHeader(&h)
+			if err != nil {
+				return err
+			}
+			if _, err := fw.Write(e.data); err != nil {
+				return err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	} else {
+		var gw *gzip.Writer
+		var tw *tar.Writer
+		if format == formatTarGzip {
+			gw = gzip.NewWriter(&buf)
+			tw = tar.NewWriter(gw)
+		} else {
+			tw = tar.NewWriter(&buf)
+		}
+		for _, e := range entries {
+			h := *e.tarHeader
+			h.Size = int64(len(e.data))
+			if err := tw.WriteHeader(&h); err != nil {
+				return err
+			}
+			if _, err := tw.Write(e.data); err != nil {
+				return err
+			}
+		}
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		if gw != nil {
+			if err := gw.Close(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return ioutil.WriteFile(filename, buf.Bytes(), 0644)
+}
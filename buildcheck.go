@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// writtenFile is the content of a file before it was overwritten by '-w'.
+type writtenFile struct {
+	src  []byte
+	perm os.FileMode
+}
+
+// writtenFiles maps each directory containing files written by '-w' to the
+// original content of those files, so that they can be restored by
+// '-build-check'. writtenOrder is the names of the files in the order
+// written. They are only populated with '-build-check'.
+var (
+	writtenFiles = make(map[string]map[string]writtenFile)
+	writtenOrder []string
+)
+
+func recordWrite(filename string, src []byte, perm os.FileMode) {
+	dir := filepath.Dir(filename)
+	if writtenFiles[dir] == nil {
+		writtenFiles[dir] = make(map[string]writtenFile)
+	}
+	if _, ok := writtenFiles[dir][filename]; !ok {
+		writtenOrder = append(writtenOrder, filename)
+	}
+	writtenFiles[dir][filename] = writtenFile{src, perm}
+}
+
+// checkBuilds runs 'go build' on the package in each directory containing
+// files written by '-w'. If a package fails to build, the failure is written
+// to w and the package's files are restored to their original content.
+// Afterwards, for '-print-changed' or '-l', whose output is delayed until
+// then, the names of the files that remain changed are written to out, and
+// anyChanged is updated for the restored files.
+func checkBuilds(out, w io.Writer) {
+	var dirs []string
+	for d := range writtenFiles {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		out, err := goBuild(dir)
+		if err == nil {
+			continue
+		}
+		fmt.Fprintf(w, "build check failed for %s: %s; restoring its files\n", dir, err)
+		w.Write(out)
+		setExitCode(1)
+
+		var names []string
+		for name := range writtenFiles[dir] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			f := writtenFiles[dir][name]
+			if err := ioutil.WriteFile(name, f.src, f.perm); err != nil {
+				fmt.Fprintln(w, err)
+			}
+		}
+		delete(modifiedDirs, dir)
+		delete(writtenFiles, dir)
+	}
+
+	anyChanged = len(writtenFiles) != 0
+	if *printChg || *list {
+		for _, name := range writtenOrder {
+			if _, ok := writtenFiles[filepath.Dir(name)][name]; ok {
+				fmt.Fprintln(out, name)
+			}
+		}
+	}
+}
+
+// goBuild builds the package in dir, discarding the result, and returns the
+// output of the go command.
+func goBuild(dir string) ([]byte, error) {
+	cmd := exec.Command("go", "build", "-o", os.DevNull, ".")
+	cmd.Dir = dir
+	return cmd.CombinedOutput()
+}
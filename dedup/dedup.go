@@ -0,0 +1,1551 @@
+// Package dedup removes duplicate imports, which have the same import path
+// but different import names, from Go source files, and rewrites the rest of
+// the file to use the kept imports. It is the library behind the dedupimport
+// command, for editor plugins and other tools that want to dedupe imports
+// without running the command.
+//
+// Options correspond to the command's flags; the zero Options are the
+// command's defaults. See the command's documentation for details of the
+// strategies and options.
+//
+// The package doesn't panic on any source that go/parser accepts, including
+// files with unusual import paths such as "", ".", or `raw` strings. Should
+// processing a file fail unexpectedly anyway, ProcessFile and Duplicates
+// return an *InternalError instead of panicking.
+package dedup
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Options control how duplicate imports are removed. Each option corresponds
+// to a dedupimport flag, named in the option's comment. The zero value of each
+// option is the flag's default.
+type Options struct {
+	// Strategy is the name of the KeepStrategy that chooses which import to
+	// keep of a group of duplicates: "unnamed", "first", "last", "comment",
+	// "named", "longest", "shortest-path", "least-churn", or one made
+	// available by RegisterStrategy. The default is "unnamed". (-keep)
+	Strategy string
+	// Strict reports an error for a group of duplicates for which the
+	// strategy can't uniquely choose an import. (-strict-strategy)
+	Strict bool
+	// PreferExplicit keeps a named import instead of the unnamed import
+	// with the "unnamed" strategy, if the unnamed import's package name
+	// would be guessed. (-prefer-explicit-on-conflict)
+	PreferExplicit bool
+	// IgnoreDirectives doesn't count directive-only comments, such as
+	// "//nolint", with the "comment" strategy. (-comment-ignore-directives)
+	IgnoreDirectives bool
+	// PinMarker, if not empty, keeps the duplicate import with a comment
+	// beginning with the marker, regardless of the strategy. (-pin-marker)
+	PinMarker string
+	// KeepPathRegexp, if set, keeps the first duplicate import whose path,
+	// as written in the source, matches, before the strategy is consulted.
+	// Paths only differ within a group with Canonicalize, such as when
+	// preferring imports written with the /v2 path. (-keep-path-regexp)
+	KeepPathRegexp *regexp.Regexp
+	// DistinctAliases only removes imports with the same name and path.
+	// (-treat-aliases-as-distinct)
+	DistinctAliases bool
+	// CollapseBlank removes side-effect imports when a regular import of
+	// the same path exists. (-collapse-redundant-blank)
+	CollapseBlank bool
+	// NameFilter, if set, only removes the duplicate imports of packages
+	// whose names match, such as `pb$` for protobuf packages. The name is
+	// the package's name, as for an unnamed import, regardless of the import
+	// names used. (-name-filter)
+	NameFilter *regexp.Regexp
+
+	// ImportOnly only modifies imports, without rewriting the rest of the
+	// file. (-i)
+	ImportOnly bool
+	// ImportsOnlyParse parses only the package clause and the imports.
+	// (-imports-only-parse)
+	ImportsOnlyParse bool
+	// AllErrors reports all parse errors, not just the first 10 on
+	// different lines. (-e)
+	AllErrors bool
+
+	// PackageNames maps import paths to package names, for packages whose
+	// names can't be resolved or guessed correctly. (-m)
+	PackageNames map[string]string
+	// Resolver, if set, is consulted for the package name of an import
+	// path, as imported by a file in srcDir, before it is looked up in the
+	// package's source files or guessed from the path. The name is used if
+	// ok is true. PackageNames takes precedence.
+	Resolver func(importPath, srcDir string) (name string, ok bool)
+	// Canonicalize maps module base paths to major versions, such as "v2",
+	// to rewrite imports of the modules to before removing duplicates.
+	// (-canonicalize)
+	Canonicalize map[string]string
+
+	// Region, if set, limits the rewritten selectors to a range of byte
+	// offsets. (-region)
+	Region Region
+	// KeepDocReferenced keeps duplicate imports whose package name is used,
+	// as in pkg.Name, in a comment. (-keep-doc-referenced)
+	KeepDocReferenced bool
+	// RewriteGenerate also rewrites package names used in //go:generate
+	// directives. (-rewrite-generate)
+	RewriteGenerate bool
+	// OnConflict is what to do with a file whose references can't be
+	// rewritten: "skip-file", the default, or "partial". (-on-conflict)
+	OnConflict string
+	// FixNameCollisions aliases imports whose package names collide with
+	// other imports, instead of reporting an error, if rewritten references
+	// would use the alias. (-fix-name-collisions)
+	FixNameCollisions bool
+	// MaxErrors, if positive, is the most rewrite errors reported for a
+	// file. (-max-errors)
+	MaxErrors int
+
+	// KeepSlot is where to keep a group of duplicate imports: "kept", the
+	// default, "first", or "last". (-keep-slot)
+	KeepSlot string
+	// KeepCommentFrom is whose comments a group of duplicate imports keeps:
+	// "slot", the default, "first", or "last". (-keep-comment-from)
+	KeepCommentFrom string
+	// Comments is what to do with the comments of duplicate imports:
+	// "keep", the default, "merge", or "drop". (-comments)
+	Comments string
+	// TrimTrailingComment removes the line comments of the kept imports of
+	// groups of duplicate imports, after the other comment options are
+	// applied. Doc comments are left as is. (-trim-trailing-comment)
+	TrimTrailingComment bool
+
+	// Simplify also simplifies code, like gofmt -s. (-simplify)
+	Simplify bool
+	// OrderSentinel, if not empty, is a comment prefix; imports in files
+	// with such a comment aren't sorted. (-order-sentinel)
+	OrderSentinel string
+	// TabWidth is the tab width used when formatting output. The default
+	// is 8. (-tabwidth)
+	TabWidth int
+	// UseSpaces indents output with spaces instead of tabs. (-use-spaces)
+	UseSpaces bool
+
+	// DumpAST sets Result.AST to a dump of the AST of a rewritten file, for
+	// debugging. (-ast)
+	DumpAST bool
+}
+
+// withDefaults returns the options with the defaults filled in.
+func (o Options) withDefaults() Options {
+	if o.Strategy == "" {
+		o.Strategy = "unnamed"
+	}
+	if o.OnConflict == "" {
+		o.OnConflict = "skip-file"
+	}
+	if o.KeepSlot == "" {
+		o.KeepSlot = "kept"
+	}
+	if o.KeepCommentFrom == "" {
+		o.KeepCommentFrom = "slot"
+	}
+	if o.Comments == "" {
+		o.Comments = "keep"
+	}
+	if o.TabWidth == 0 {
+		o.TabWidth = 8
+	}
+	return o
+}
+
+// deduper removes duplicate imports with a set of options.
+type deduper struct {
+	Options
+
+	// writtenPaths are the import paths as written in the source, for the
+	// specs whose paths were rewritten by canonicalizePaths.
+	writtenPaths map[*ast.ImportSpec]string
+}
+
+// keepStrategy returns the KeepStrategy for d.Strategy.
+func (d *deduper) keepStrategy() KeepStrategy {
+	if d.Strategy == "comment" && d.IgnoreDirectives {
+		return strictFunc(keepCommentText)
+	}
+	if d.Strategy == "shortest-path" {
+		return strictFunc(func(group []*ast.ImportSpec) (int, bool) {
+			return keepShortestWrittenPath(group, d.writtenPaths)
+		})
+	}
+	return strategies[d.Strategy]
+}
+
+func newDeduper(opts Options) (*deduper, error) {
+	opts = opts.withDefaults()
+	if _, ok := strategies[opts.Strategy]; !ok {
+		return nil, fmt.Errorf("unknown strategy %s (must be one of: %s)", opts.Strategy, strings.Join(StrategyNames(), ", "))
+	}
+	return &deduper{Options: opts}, nil
+}
+
+// Process removes duplicate imports from the Go source src and rewrites the
+// rest of the source to use the kept imports. filename is used in positions
+// in errors, and its directory is used to look up package names. It returns
+// src if there are no duplicate imports.
+//
+// If the file can't be rewritten, such as when a selector expression can't
+// be rewritten safely, the error is a MultiError describing each problem.
+func Process(src []byte, filename string, opts Options) ([]byte, error) {
+	result, err := ProcessFile(token.NewFileSet(), src, filename, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result.Output, nil
+}
+
+// ProcessFile is like Process, but it returns a Result describing the
+// changes made. Positions are recorded in fset. A nil error is returned for a
+// file without duplicate imports. If the file could not be rewritten, the
+// returned Result describes the conflicts, and the error is a MultiError
+// describing them as well.
+func ProcessFile(fset *token.FileSet, src []byte, filename string, opts Options) (result *Result, err error) {
+	defer recoverInternal(filename, &err)
+	d, err := newDeduper(opts)
+	if err != nil {
+		return nil, err
+	}
+	return d.processFile(fset, src, filename)
+}
+
+func (d *deduper) processFile(fset *token.FileSet, src []byte, filename string) (*Result, error) {
+	result, err := d.processFile_(fset, src, filename, nil)
+	if err == nil || d.OnConflict != "partial" || result == nil || len(result.Conflicts) == 0 {
+		return result, err
+	}
+
+	// With OnConflict "partial", keep the duplicate imports whose
+	// references can't be rewritten and process the file again, until the
+	// remaining groups can be deduplicated.
+	skip := make(map[string]bool)
+	var conflicts []ConflictInfo
+	for err != nil && len(result.Conflicts) != 0 {
+		for _, c := range result.Conflicts {
+			skip[c.From] = true
+		}
+		conflicts = append(conflicts, result.Conflicts...)
+		result, err = d.processFile_(fset, src, filename, skip)
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Conflicts = conflicts
+	for _, c := range conflicts {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%s (keeping import %s)", c.Message, c.From))
+	}
+	return result, nil
+}
+
+// Duplicates returns the imports in the Go source src that would be removed
+// as duplicates, and the imports that would be kept instead, without
+// returning the rewritten file. Positions are recorded in fset.
+//
+// The duplicates are found as by ProcessFile, with all of the options, and
+// are the same as the returned Result's RemovedSpecs. In particular, the
+// error is the same: a file that ProcessFile can't rewrite, such as when
+// selector expressions can't be rewritten safely, is an error rather than
+// reported as having duplicates.
+func Duplicates(fset *token.FileSet, src []byte, filename string, opts Options) (specs []SpecInfo, err error) {
+	result, err := ProcessFile(fset, src, filename, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result.RemovedSpecs, nil
+}
+
+func (d *deduper) parserMode() parser.Mode {
+	if d.AllErrors {
+		return parser.ParseComments | parser.AllErrors
+	}
+	return parser.ParseComments
+}
+
+// Region is a range of byte offsets [Start, End) in a file, for
+// Options.Region.
+type Region struct {
+	Start, End int
+	set        bool
+}
+
+func (r *Region) String() string {
+	if !r.set {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", r.Start, r.End)
+}
+
+func (r *Region) Set(val string) error {
+	c := strings.Split(val, ":")
+	if len(c) != 2 {
+		return fmt.Errorf("wrong format for -region: %s", val)
+	}
+	start, err := strconv.Atoi(c[0])
+	if err != nil {
+		return fmt.Errorf("bad start for -region: %s", err)
+	}
+	end, err := strconv.Atoi(c[1])
+	if err != nil {
+		return fmt.Errorf("bad end for -region: %s", err)
+	}
+	if start < 0 || end < start {
+		return fmt.Errorf("bad range for -region: %s", val)
+	}
+	r.Start, r.End, r.set = start, end, true
+	return nil
+}
+
+// contains reports whether the region contains the offset. An unset region
+// contains every offset.
+func (r *Region) contains(offset int) bool {
+	return !r.set || r.Start <= offset && offset < r.End
+}
+
+// bom is the UTF-8 byte order mark. A BOM at the start of a file is
+// preserved in the output.
+var bom = []byte{0xEF, 0xBB, 0xBF}
+
+type posSpan struct {
+	Start token.Pos
+	End   token.Pos
+}
+
+// processFile_ is processFile, but it doesn't remove the duplicate imports
+// whose package names are in skip.
+func (d *deduper) processFile_(fset *token.FileSet, src []byte, filename string, skip map[string]bool) (*Result, error) {
+	mode := d.parserMode()
+	if d.ImportsOnlyParse {
+		mode |= parser.ImportsOnly
+	}
+	file, err := parser.ParseFile(fset, filename, src, mode)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Output: src}
+	if len(file.Imports) == 0 || len(file.Imports) < 2 && len(d.Canonicalize) == 0 {
+		// fast path: no duplicates are possible, and, without imports,
+		// nothing to canonicalize. This is the case for most files in a
+		// typical tree.
+		return result, nil
+	}
+
+	result.Warnings = append(result.Warnings, badImportPathWarnings(fset, file.Imports)...)
+
+	// With Options.ImportsOnlyParse, the rest of the file after the import
+	// declarations, rest, isn't parsed; it is appended to the output as is.
+	var rest []byte
+	if d.ImportsOnlyParse {
+		end := file.Decls[len(file.Decls)-1].End()
+		rest = src[fset.Position(end).Offset:]
+		// The parser may have scanned comments past the end.
+		var comments []*ast.CommentGroup
+		for _, cg := range file.Comments {
+			if cg.End() <= end {
+				comments = append(comments, cg)
+			}
+		}
+		file.Comments = comments
+	}
+
+	// Rewrite paths before grouping, so that the rewritten imports are
+	// deduplicated with existing imports of the major version path.
+	canonicalized := d.canonicalizePaths(file.Imports)
+
+	// Record positions for specs.
+	// Need to do this before updating file.Imports.
+	pos := make([]posSpan, len(file.Imports))
+	for i, s := range file.Imports {
+		pos[i] = posSpan{s.Pos(), s.End()}
+	}
+
+	srcDir := filepath.Dir(filename)
+
+	// Find duplicate imports.
+	var uses map[string]int
+	if _, ok := d.keepStrategy().(UsageKeepStrategy); ok {
+		uses = selectorUses(file)
+	}
+	imports, err := d.markDuplicates(fset, file.Imports, srcDir, uses)
+	if err != nil {
+		return nil, err
+	}
+	for _, im := range imports {
+		if im.remove && skip[d.packageNameForImport(im.spec, srcDir)] {
+			im.remove = false
+			im.subsumedBy = nil
+		}
+	}
+	if d.DistinctAliases {
+		result.Warnings = append(result.Warnings, distinctAliasWarnings(fset, imports)...)
+	}
+	if d.ImportsOnlyParse {
+		result.Warnings = append(result.Warnings, d.keepRenamed(fset, imports, srcDir)...)
+	}
+	if d.Region.set {
+		d.keepOutsideRegion(fset, file, imports, srcDir)
+	}
+	if d.KeepDocReferenced {
+		result.Warnings = append(result.Warnings, d.keepCommentReferenced(fset, file, imports, srcDir)...)
+	}
+	if d.KeepSlot != "kept" {
+		d.moveToSlots(imports)
+	}
+
+	var keep, remove []*ast.ImportSpec
+	for _, im := range imports {
+		if im.remove {
+			remove = append(remove, im.spec)
+		} else {
+			keep = append(keep, im.spec)
+		}
+	}
+	if len(remove) == 0 && !canonicalized {
+		// nothing to do
+		return result, nil
+	}
+
+	// Don't write a file whose imports collide on package names, even if
+	// they already did.
+	warnings, err := d.checkNameCollisions(fset, file, imports, keep, srcDir)
+	result.Warnings = append(result.Warnings, warnings...)
+	if err != nil {
+		return result, err
+	}
+
+	for _, im := range imports {
+		if im.remove {
+			result.RemovedSpecs = append(result.RemovedSpecs, newSpecInfo(fset, im))
+		}
+	}
+
+	// Record the edits, while positions are those of the source.
+	removed := make(map[*ast.ImportSpec]bool)
+	for _, spec := range remove {
+		removed[spec] = true
+	}
+	edits := removalEdits(fset, file, src, func(spec *ast.ImportSpec) bool { return removed[spec] })
+
+	// Record comments.
+	cmap := ast.NewCommentMap(fset, file, file.Comments)
+
+	file.Imports = keep   // update the file's imports.
+	trimImportDecls(file) // update the file's AST.
+
+	// Get rid of comments that no longer belong.
+	file.Comments = cmap.Filter(file).Comments()
+
+	if !d.ImportOnly && !d.ImportsOnlyParse {
+		// Get the identifiers in scopes.
+		// We need it to check if rewriting selector exprs is safe.
+		scope := walkFile(file)
+
+		// Build up the selector expr rewrite rules.
+		rules := make(map[string]string)
+		for _, im := range imports {
+			if !im.remove {
+				continue
+			}
+			if im.spec.Name != nil && im.spec.Name.Name == "_" {
+				// nothing refers to a blank import.
+				continue
+			}
+			from := d.packageNameForImport(im.spec, srcDir)
+			to := d.packageNameForImport(im.subsumedBy, srcDir)
+			if from == to {
+				// selectors already refer to the kept import.
+				continue
+			}
+			rules[from] = to
+		}
+
+		// Rewrite.
+		rewrites, err := d.rewriteSelectorExprs(fset, rules, scope, file.Name.Name)
+		result.Rewrites = rewrites
+		if err != nil {
+			for _, e := range err.(MultiError) {
+				e, ok := e.(rewriteError)
+				if !ok {
+					continue // omittedErrors
+				}
+				from, to := e.names()
+				result.Conflicts = append(result.Conflicts, ConflictInfo{e.pos(), from, to, e.Error()})
+			}
+			return result, err
+		}
+
+		if d.RewriteGenerate {
+			rewriteGenerateDirectives(file, rules)
+		}
+	}
+
+	// If an import is removed, merge the next line into it.
+	for _, im := range imports {
+		if im.remove {
+			pos := im.spec.Pos()
+			line := fset.Position(pos).Line
+			fp := fset.File(pos)
+			if line >= fp.LineCount() {
+				// don't do merging at end of file
+				continue
+			}
+			fp.MergeLine(line)
+		}
+	}
+	// Update the positions we recorded earlier.
+	// Don't have to worry about fixing up comments here
+	// because comments for removed imports would have already been removed
+	// by the commentMap work earlier.
+	for i, im := range imports {
+		s := im.spec
+		if s.Name != nil {
+			s.Name.NamePos = pos[i].Start
+		}
+		s.Path.ValuePos = pos[i].Start
+		s.EndPos = pos[i].End
+	}
+
+	if d.Simplify {
+		simplify(file)
+	}
+
+	switch d.Comments {
+	case "merge":
+		mergeComments(file, imports)
+	case "drop":
+		dropComments(fset, file, imports)
+	}
+	if d.KeepCommentFrom != "slot" {
+		d.commentsFrom(fset, file, imports)
+	}
+	if d.TrimTrailingComment {
+		trimTrailingComments(file, imports)
+	}
+
+	if d.DumpAST {
+		var buf bytes.Buffer
+		if err := ast.Fprint(&buf, fset, file, ast.NotNilFilter); err != nil {
+			return nil, err
+		}
+		result.AST = buf.Bytes()
+	}
+
+	out, err := d.formatFile(fset, file)
+	if err != nil {
+		return nil, err
+	}
+	if d.ImportsOnlyParse {
+		out = append(bytes.TrimRight(out, "\n"), rest...)
+	}
+	if bytes.HasPrefix(src, bom) {
+		// The parser skips a leading BOM, so the printer doesn't
+		// print it. Preserve it.
+		out = append(append([]byte(nil), bom...), out...)
+	}
+	result.Changed = true
+	result.Edits = append(edits, renameEdits(src, result.Rewrites)...)
+	result.Output = out
+	return result, nil
+}
+
+// keepCommentReferenced unmarks imports for removal if their package name is
+// used as a selector, like "pkg.Foo", in a comment in the file. It returns a
+// warning for each such import.
+func (d *deduper) keepCommentReferenced(fset *token.FileSet, file *ast.File, imports []*importSpec, srcDir string) []string {
+	var warnings []string
+	for _, im := range imports {
+		if !im.remove || (im.spec.Name != nil && im.spec.Name.Name == "_") {
+			continue
+		}
+		from := d.packageNameForImport(im.spec, srcDir)
+		if from == d.packageNameForImport(im.subsumedBy, srcDir) {
+			continue
+		}
+		re := regexp.MustCompile(`(^|[^\pL\pN_.])` + regexp.QuoteMeta(from) + `\.[\pL_]`)
+	Comments:
+		for _, cg := range file.Comments {
+			for _, c := range cg.List {
+				if re.MatchString(c.Text) {
+					warnings = append(warnings, fmt.Sprintf("%s: keeping duplicate import %s %s: referenced in comment at %s",
+						fset.Position(im.spec.Pos()), from, im.spec.Path.Value, fset.Position(c.Pos())))
+					im.remove = false
+					im.subsumedBy = nil
+					break Comments
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// checkNameCollisions returns an error for each kept import whose package
+// name is the same as that of an earlier kept import of a different path,
+// where at least one of the two names is implied by the import path. With
+// Options.FixNameCollisions, it instead aliases such imports to an unused
+// name, so that the selectors rewritten to use the import use the alias, and
+// returns a warning for each, since the other references in the file are
+// left as is. An import that no selector is rewritten to use isn't aliased,
+// since the alias would be unused, and the collision is an error.
+func (d *deduper) checkNameCollisions(fset *token.FileSet, file *ast.File, imports []*importSpec, keep []*ast.ImportSpec, srcDir string) ([]string, error) {
+	var used map[string]bool             // identifier names in the file; for Options.FixNameCollisions
+	var targets map[*ast.ImportSpec]bool // kept imports that selectors are rewritten to use
+	if d.FixNameCollisions {
+		used = make(map[string]bool)
+		ast.Inspect(file, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+			return true
+		})
+		targets = make(map[*ast.ImportSpec]bool)
+		if d.ImportOnly || d.ImportsOnlyParse {
+			// no selectors are rewritten.
+			imports = nil
+		}
+		uses := selectorUses(file)
+		for _, im := range imports {
+			if !im.remove || im.subsumedBy == nil || im.spec.Name != nil && im.spec.Name.Name == "_" {
+				continue
+			}
+			from := d.packageNameForImport(im.spec, srcDir)
+			if uses[from] != 0 && from != d.packageNameForImport(im.subsumedBy, srcDir) {
+				targets[im.subsumedBy] = true
+			}
+		}
+	}
+
+	var warnings []string
+	var errs MultiError
+	byName := make(map[string]*ast.ImportSpec)
+	for _, spec := range keep {
+		if spec.Name != nil && (spec.Name.Name == "_" || spec.Name.Name == ".") {
+			continue
+		}
+		if path, _ := normalizeImportPath(spec.Path.Value); isBadImportPath(path) {
+			continue
+		}
+		name := d.packageNameForImport(spec, srcDir)
+		other, ok := byName[name]
+		if !ok || other.Path.Value == spec.Path.Value || (spec.Name != nil && other.Name != nil) {
+			// explicitly named imports that collide are left alone; the
+			// collision is visible in the source.
+			byName[name] = spec
+			continue
+		}
+		if !d.FixNameCollisions || !targets[spec] {
+			errs = append(errs, &NameCollisionError{fset.Position(spec.Pos()), name, spec.Path.Value, fset.Position(other.Pos()).Line, d.FixNameCollisions})
+			continue
+		}
+		alias := name
+		for n := 2; used[alias] || byName[alias] != nil; n++ {
+			alias = name + strconv.Itoa(n)
+		}
+		used[alias] = true
+		byName[alias] = spec
+		warnings = append(warnings, fmt.Sprintf("%s: aliased import %s as %s: package name collides with import on line %d; other references to %s were not changed",
+			fset.Position(spec.Pos()), spec.Path.Value, alias, fset.Position(other.Pos()).Line, name))
+		spec.Name = &ast.Ident{NamePos: spec.Path.Pos(), Name: alias}
+	}
+	if len(errs) != 0 {
+		return warnings, errs
+	}
+	return warnings, nil
+}
+
+// keepRenamed unmarks imports for removal if removing them would require
+// rewriting selector expressions, which can't be done with
+// Options.ImportsOnlyParse. It returns a warning for each such import.
+func (d *deduper) keepRenamed(fset *token.FileSet, imports []*importSpec, srcDir string) []string {
+	var warnings []string
+	for _, im := range imports {
+		if !im.remove || (im.spec.Name != nil && im.spec.Name.Name == "_") {
+			continue
+		}
+		from := d.packageNameForImport(im.spec, srcDir)
+		if from == d.packageNameForImport(im.subsumedBy, srcDir) {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("%s: keeping duplicate import %s %s: cannot rewrite references with -imports-only-parse",
+			fset.Position(im.spec.Pos()), from, im.spec.Path.Value))
+		im.remove = false
+		im.subsumedBy = nil
+	}
+	return warnings
+}
+
+// keepOutsideRegion unmarks imports for removal if their package name is used
+// as a selector outside the Options.Region range, since those selectors are
+// not rewritten. It is conservative: selectors referring to local declarations
+// that shadow the import also count.
+func (d *deduper) keepOutsideRegion(fset *token.FileSet, file *ast.File, imports []*importSpec, srcDir string) {
+	for _, im := range imports {
+		if !im.remove || (im.spec.Name != nil && im.spec.Name.Name == "_") {
+			continue
+		}
+		from := d.packageNameForImport(im.spec, srcDir)
+		if from == d.packageNameForImport(im.subsumedBy, srcDir) {
+			continue
+		}
+		ast.Inspect(file, func(node ast.Node) bool {
+			if !im.remove {
+				return false
+			}
+			x, ok := node.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if ident, ok := selectorIdent(x); ok && ident.Name == from && !d.Region.contains(fset.Position(ident.Pos()).Offset) {
+				im.remove = false
+				im.subsumedBy = nil
+			}
+			return true
+		})
+	}
+}
+
+// rewriteGenerateDirectives rewrites package names used as selectors, like
+// "pkg.Foo", in the file's //go:generate directives based on the rewrite
+// rules.
+func rewriteGenerateDirectives(file *ast.File, rules map[string]string) {
+	for from, to := range rules {
+		re := regexp.MustCompile(`(^|[^\pL\pN_.])` + regexp.QuoteMeta(from) + `\.([\pL_])`)
+		for _, cg := range file.Comments {
+			for _, c := range cg.List {
+				if !strings.HasPrefix(c.Text, "//go:generate ") {
+					continue
+				}
+				// Only rewrite the arguments, not the directive name.
+				args := c.Text[len("//go:generate"):]
+				c.Text = "//go:generate" + re.ReplaceAllString(args, "${1}"+to+".${2}")
+			}
+		}
+	}
+}
+
+// mergeComments moves the comments of removed import specs onto the specs
+// that replace them. The text of each comment is appended to the kept spec's
+// line comment, separated by "; ".
+func mergeComments(file *ast.File, imports []*importSpec) {
+	merged := make(map[*ast.ImportSpec][]string)
+	var order []*ast.ImportSpec
+	for _, im := range imports {
+		if !im.remove {
+			continue
+		}
+		texts := append(commentTexts(im.spec.Doc), commentTexts(im.spec.Comment)...)
+		if len(texts) == 0 {
+			continue
+		}
+		kept := im.subsumedBy
+		if _, ok := merged[kept]; !ok {
+			order = append(order, kept)
+		}
+		merged[kept] = append(merged[kept], texts...)
+	}
+
+	for _, kept := range order {
+		texts := append(commentTexts(kept.Comment), merged[kept]...)
+		c := &ast.Comment{Slash: kept.End(), Text: "// " + strings.Join(texts, "; ")}
+		if kept.Comment != nil {
+			c.Slash = kept.Comment.Pos()
+			removeCommentGroup(file, kept.Comment)
+		}
+		kept.Comment = &ast.CommentGroup{List: []*ast.Comment{c}}
+		addCommentGroup(file, kept.Comment)
+	}
+}
+
+// dropComments removes the doc and line comments of the kept import specs
+// that replace removed specs.
+func dropComments(fset *token.FileSet, file *ast.File, imports []*importSpec) {
+	for _, im := range imports {
+		if !im.remove {
+			continue
+		}
+		removeSpecComments(fset, file, im.subsumedBy)
+	}
+}
+
+// trimTrailingComments removes the line comments of the kept import specs
+// that replace removed specs, leaving their doc comments.
+func trimTrailingComments(file *ast.File, imports []*importSpec) {
+	for _, im := range imports {
+		if !im.remove || im.subsumedBy.Comment == nil {
+			continue
+		}
+		removeCommentGroup(file, im.subsumedBy.Comment)
+		im.subsumedBy.Comment = nil
+	}
+}
+
+// removeSpecComments removes the doc and line comments of the import spec.
+func removeSpecComments(fset *token.FileSet, file *ast.File, spec *ast.ImportSpec) {
+	if spec.Doc != nil {
+		// Merge the lines that the doc comment occupied, so that they
+		// don't become a blank line.
+		fp := fset.File(spec.Doc.Pos())
+		first := fset.Position(spec.Doc.Pos()).Line
+		last := fset.Position(spec.Doc.End()).Line
+		for l := first; l <= last; l++ {
+			fp.MergeLine(first)
+		}
+		removeCommentGroup(file, spec.Doc)
+		spec.Doc = nil
+	}
+	if spec.Comment != nil {
+		removeCommentGroup(file, spec.Comment)
+		spec.Comment = nil
+	}
+}
+
+// groupMembers returns the kept import spec and the regular import specs it
+// replaces, in source order.
+func groupMembers(imports []*importSpec, kept *ast.ImportSpec) []*importSpec {
+	var members []*importSpec
+	for _, im := range imports {
+		if im.spec == kept || im.subsumedBy == kept && importName(im.spec) != "_" {
+			members = append(members, im)
+		}
+	}
+	return members
+}
+
+// slotMember returns the first or the last of the members, for the value of
+// Options.KeepSlot or Options.KeepCommentFrom.
+func slotMember(members []*importSpec, which string) *importSpec {
+	if which == "first" {
+		return members[0]
+	}
+	return members[len(members)-1]
+}
+
+// moveToSlots moves each kept import to the slot given by Options.KeepSlot
+// among the imports it replaces. The spec at the slot is kept instead, and the
+// names of the two specs are swapped, so that the same name is kept and the
+// same selector expressions are rewritten. Each spec keeps its own comments.
+func (d *deduper) moveToSlots(imports []*importSpec) {
+	for _, k := range imports {
+		if k.remove {
+			continue
+		}
+		members := groupMembers(imports, k.spec)
+		if len(members) < 2 {
+			continue
+		}
+		s := slotMember(members, d.KeepSlot)
+		if s == k {
+			continue
+		}
+		s.spec.Name, k.spec.Name = k.spec.Name, s.spec.Name
+		for _, im := range imports {
+			if im.subsumedBy == k.spec {
+				im.subsumedBy = s.spec
+			}
+		}
+		s.remove, s.subsumedBy = false, nil
+		k.remove, k.subsumedBy = true, s.spec
+	}
+}
+
+// commentsFrom replaces the comments of each kept import spec with those of
+// the spec in its group given by Options.KeepCommentFrom. The comments are
+// joined into a line comment, as with Comments "merge".
+func (d *deduper) commentsFrom(fset *token.FileSet, file *ast.File, imports []*importSpec) {
+	for _, k := range imports {
+		if k.remove {
+			continue
+		}
+		members := groupMembers(imports, k.spec)
+		if len(members) < 2 {
+			continue
+		}
+		from := slotMember(members, d.KeepCommentFrom)
+		if from == k {
+			continue
+		}
+		texts := append(commentTexts(from.spec.Doc), commentTexts(from.spec.Comment)...)
+		removeSpecComments(fset, file, k.spec)
+		if len(texts) != 0 {
+			k.spec.Comment = &ast.CommentGroup{List: []*ast.Comment{{Slash: k.spec.End(), Text: "// " + strings.Join(texts, "; ")}}}
+			addCommentGroup(file, k.spec.Comment)
+		}
+	}
+}
+
+// commentTexts returns the text of each non-empty line in the comment group,
+// without comment markers.
+func commentTexts(cg *ast.CommentGroup) []string {
+	if cg == nil {
+		return nil
+	}
+	var texts []string
+	for _, line := range strings.Split(cg.Text(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			texts = append(texts, line)
+		}
+	}
+	return texts
+}
+
+func removeCommentGroup(file *ast.File, cg *ast.CommentGroup) {
+	for i, c := range file.Comments {
+		if c == cg {
+			file.Comments = append(file.Comments[:i], file.Comments[i+1:]...)
+			return
+		}
+	}
+}
+
+// addCommentGroup adds the comment group to the file's comments, keeping
+// them sorted by position.
+func addCommentGroup(file *ast.File, cg *ast.CommentGroup) {
+	i := sort.Search(len(file.Comments), func(i int) bool {
+		return file.Comments[i].Pos() > cg.Pos()
+	})
+	file.Comments = append(file.Comments, nil)
+	copy(file.Comments[i+1:], file.Comments[i:])
+	file.Comments[i] = cg
+}
+
+type scopeStack struct {
+	list []*Scope
+}
+
+func (s *scopeStack) push(sc *Scope) {
+	s.list = append(s.list, sc)
+}
+
+func (s *scopeStack) pop() *Scope {
+	if len(s.list) == 0 {
+		panic("pop of zero-length stack")
+	}
+	res := s.list[len(s.list)-1]
+	s.list = s.list[:len(s.list)-1]
+	return res
+}
+
+// latest returns the latest non-nil entry in the stack
+// or nil if there is no such entry.
+func (s *scopeStack) latest() *Scope {
+	for i := len(s.list) - 1; i >= 0; i-- {
+		if s.list[i] != nil {
+			return s.list[i]
+		}
+	}
+	return nil
+}
+
+// rewriteSelectorExprs rewrites selector exprs in the supplied scope based
+// on the rewrite rules, and returns the rewrites performed. If a rewrite could
+// not be performed, it will be described in the returned error. The returned
+// error will be of type MultiError (even if there was only a single error),
+// with elements implementing rewriteError, except for a final omittedErrors
+// if errors were omitted due to Options.MaxErrors.
+func (d *deduper) rewriteSelectorExprs(fset *token.FileSet, rules map[string]string, root *Scope, pkgName string) ([]RewriteInfo, error) {
+	// first, map nodes to their scopes.
+	scopeByNode := make(map[ast.Node]*Scope)
+	root.each(func(s *Scope) bool {
+		scopeByNode[s.node] = s
+		return true
+	})
+
+	var errs MultiError
+	omitted := 0
+	addError := func(e error) {
+		if d.MaxErrors > 0 && len(errs) >= d.MaxErrors {
+			omitted++
+			return
+		}
+		errs = append(errs, e)
+	}
+	var rewrites []RewriteInfo
+
+	// NOTE: this doesn't protect against package scope variables fully.
+	// For instance, 'var fe int' could be in a different file and visible
+	// across the package, but we would not warn about a "frontend" -> "fe"
+	// selector rewrite. This is okay for the most part, because
+	// the code would have had a compile error before anyway.
+	var stack scopeStack
+	ast.Inspect(root.node, func(node ast.Node) bool {
+		sc := scopeByNode[node]
+		if node != nil {
+			// enter a deeper level.  sc may be nil (because the node
+			// wasn't a scope creating node).
+			// the latest non-nil sc is the scope we want to track,
+			// and this is the scope that is returned by calling `latest`.
+			stack.push(sc)
+		}
+
+		switch x := node.(type) {
+		case *ast.SelectorExpr:
+			// we only care about package selector exprs,
+			// which should always have X be an *ast.Ident, possibly
+			// parenthesized.
+			ident, ok := selectorIdent(x)
+			if !ok {
+				// don't care
+				break
+			}
+			from := ident.Name
+			to, ok := rules[from]
+			if !ok {
+				// this selector expr is not one we want to rewrite
+				break
+			}
+			if !d.Region.contains(fset.Position(ident.Pos()).Offset) {
+				// outside the Options.Region range.
+				break
+			}
+			latest := stack.latest()
+			if latest == nil {
+				panicf("[code bug] selector expr should be in a scope, but unaware of any such scope")
+			}
+			if latest.shadowed(from, ident.NamePos) {
+				// the ident refers to a local declaration, not to the
+				// import, in this scope.
+				break
+			}
+			if isGoKeyword(to) {
+				// source code must already have a parse or build error.
+				addError(&GoKeywordError{fset.Position(ident.Pos()), from, to})
+				break
+			}
+			if !isValidIdent(to) {
+				// source code must already have a parse/build error.
+				addError(&InvalidIdentError{fset.Position(ident.Pos()), from, to})
+				break
+			}
+			if to == "init" {
+				// a package cannot be imported as init, so the source code
+				// must already have a build error. checked regardless of
+				// where func init is declared.
+				addError(&InitNameError{fset.Position(ident.Pos()), from})
+				break
+			}
+			if id, ok := latest.available(to); ok && id.NamePos <= ident.NamePos { // exists && declared before
+				addError(&ScopeError{fset.Position(ident.Pos()), from, to})
+				break
+			}
+			ident.Name = to // rewrite
+			rewrites = append(rewrites, RewriteInfo{fset.Position(ident.Pos()), from, to})
+		}
+
+		if node == nil {
+			// depth-first unraveling call by ast.Inspect.  pop an entry.
+			// the entry popped may be nil (see comment at `push`).
+			stack.pop()
+		}
+
+		return true
+	})
+
+	if len(errs) == 0 {
+		return rewrites, nil
+	}
+	if omitted > 0 {
+		errs = append(errs, omittedErrors(omitted))
+	}
+	return rewrites, errs
+}
+
+func isValidIdent(w string) bool {
+	// https://golang.org/ref/spec#identifier
+	if len(w) == 0 {
+		return false
+	}
+	isLetter := func(r rune) bool {
+		return unicode.In(r, unicode.Lu, unicode.Ll, unicode.Lt, unicode.Lm, unicode.Lo)
+	}
+	isNumber := func(r rune) bool {
+		return unicode.In(r, unicode.Nd)
+	}
+	for i, r := range w {
+		switch i {
+		case 0:
+			if !(isLetter(r) || r == '_') {
+				return false
+			}
+		default:
+			if !(isLetter(r) || r == '_' || isNumber(r)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isGoKeyword(w string) bool {
+	switch w {
+	case "break", "default", "func", "interface", "select",
+		"case", "defer", "go", "map", "struct",
+		"chan", "else", "goto", "package", "switch",
+		"const", "fallthrough", "if", "range", "type",
+		"continue", "for", "import", "return", "var":
+		return true
+	default:
+		return false
+	}
+}
+
+// trimImportDecls trims the file's import declarations based on the import
+// specs present in file.Imports. Import declarations that become empty as a
+// result are removed; declarations that were already empty, such as
+// "import ()", are left alone.
+func trimImportDecls(file *ast.File) {
+	lookup := make(map[*ast.ImportSpec]struct{}, len(file.Imports))
+	for _, im := range file.Imports {
+		lookup[im] = struct{}{}
+	}
+
+	emptied := make(map[*ast.GenDecl]bool)
+	for i := range file.Decls {
+		genDecl, ok := file.Decls[i].(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT || len(genDecl.Specs) == 0 {
+			continue
+		}
+		var keep []ast.Spec // type is generic so that we can use in assignment below.
+		for _, spec := range genDecl.Specs {
+			im, ok := spec.(*ast.ImportSpec)
+			if !ok {
+				// WTF, doesn't match godoc
+				panicf("expected importSpec")
+			}
+			if _, ok := lookup[im]; ok {
+				// was not removed during deduping,
+				// so append it to our list of imports to keep.
+				keep = append(keep, spec)
+			}
+		}
+		genDecl.Specs = keep
+		file.Decls[i] = genDecl
+		emptied[genDecl] = len(keep) == 0
+	}
+
+	var nonEmptyDecls []ast.Decl
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT {
+			nonEmptyDecls = append(nonEmptyDecls, decl)
+			continue
+		}
+		if !emptied[genDecl] {
+			nonEmptyDecls = append(nonEmptyDecls, decl)
+		}
+	}
+	file.Decls = nonEmptyDecls
+}
+
+// markDuplicates returns the import specs with a removal status marked.
+// Neither the input slice nor its elements are modified. srcDir is the
+// directory containing the file, used to look up package names. uses, from
+// selectorUses, is only needed for a UsageKeepStrategy.
+//
+// If Options.Strict is set and the strategy can't uniquely determine the
+// import to keep for a group, the returned error describes each such group.
+func (d *deduper) markDuplicates(fset *token.FileSet, input []*ast.ImportSpec, srcDir string, uses map[string]int) ([]*importSpec, error) {
+	imports := make([]*importSpec, len(input))
+	for i := range input {
+		imports[i] = &importSpec{spec: input[i]}
+	}
+
+	importPaths := make(map[string][]*importSpec)
+	blankPaths := make(map[string][]*importSpec)
+	dotPaths := make(map[string][]*importSpec)
+	for _, im := range imports {
+		spec := im.spec
+		// NOTE: The panics below indicate conditions that should have been
+		// caught already by the parser, which only accepts string literals
+		// as import paths. It does accept paths such as "" and ".", though;
+		// see isBadImportPath.
+		if spec.Path.Kind != token.STRING {
+			panicf("import path %s is not a string", spec.Path.Value)
+		}
+		// normalize `fmt` vs. "fmt", for instance
+		path, err := normalizeImportPath(spec.Path.Value)
+		if err != nil {
+			// wasn't a valid string?
+			panicf("unquoting path: %s", err)
+		}
+		// never dedupe the cgo pseudo-package. a file can have several
+		// 'import "C"' declarations, each with its own preamble, and
+		// references like C.int are not to a real package.
+		if path == "C" {
+			continue
+		}
+		// skip dot and side effect imports. for now, let's assume it's okay
+		// to have both these coexist with regular imports. In fact, it looks
+		// like it's necessary to not remove _ imports; that's the only way both _
+		// and regular import can be used together in a file. The exception
+		// is Options.CollapseBlank, handled below. Dot imports are only
+		// deduplicated among themselves, also below.
+		if spec.Name != nil && spec.Name.Name == "_" {
+			blankPaths[path] = append(blankPaths[path], im)
+			continue
+		}
+		if spec.Name != nil && spec.Name.Name == "." {
+			dotPaths[path] = append(dotPaths[path], im)
+			continue
+		}
+		if isBadImportPath(path) {
+			// no package name can be determined; see badImportPathWarnings.
+			continue
+		}
+		importPaths[path] = append(importPaths[path], im)
+	}
+
+	duplicateImportPaths := make(map[string][]*importSpec)
+	for p, v := range importPaths {
+		if d.DistinctAliases {
+			// only exact duplicates, with the same import name, are
+			// grouped.
+			byName := make(map[string][]*importSpec)
+			for _, im := range v {
+				byName[importName(im.spec)] = append(byName[importName(im.spec)], im)
+			}
+			for name, g := range byName {
+				if len(g) > 1 {
+					duplicateImportPaths[name+" "+p] = g
+				}
+			}
+			continue
+		}
+		if len(v) > 1 {
+			duplicateImportPaths[p] = v
+		}
+	}
+
+	keepStrategy := d.keepStrategy()
+	var errs MultiError
+
+	for _, v := range duplicateImportPaths {
+		group := make([]*ast.ImportSpec, len(v))
+		for i := range v {
+			group[i] = v[i].spec
+		}
+		if path, _ := normalizeImportPath(group[0].Path.Value); d.filteredOut(path, srcDir) {
+			continue
+		}
+		pinIdx, pins := pinned(group, d.PinMarker)
+		if pins > 1 {
+			path, _ := normalizeImportPath(group[0].Path.Value)
+			errs = append(errs, &PinError{fset.Position(group[0].Pos()), path, d.PinMarker})
+			continue
+		}
+		var keepIdx int
+		decidedBy := d.Strategy
+		pathIdx := d.matchPath(group)
+		if pins == 1 {
+			keepIdx = pinIdx
+			decidedBy = "pin"
+		} else if pathIdx != -1 {
+			keepIdx = pathIdx
+			decidedBy = "path-regexp"
+		} else if s, ok := keepStrategy.(UsageKeepStrategy); ok {
+			counts := make([]int, len(group))
+			for i := range group {
+				counts[i] = uses[d.packageNameForImport(group[i], srcDir)]
+			}
+			if s, ok := s.(StrictUsageKeepStrategy); ok && d.Strict {
+				var unique bool
+				keepIdx, unique = s.ChooseByUsageStrict(group, counts)
+				if !unique {
+					path, _ := normalizeImportPath(group[0].Path.Value)
+					errs = append(errs, &AmbiguousError{fset.Position(group[0].Pos()), path, d.Strategy})
+					continue
+				}
+			} else {
+				keepIdx = s.ChooseByUsage(group, counts)
+			}
+		} else if s, ok := keepStrategy.(StrictKeepStrategy); ok && d.Strict {
+			var unique bool
+			keepIdx, unique = s.ChooseStrict(group)
+			if !unique {
+				path, _ := normalizeImportPath(group[0].Path.Value)
+				errs = append(errs, &AmbiguousError{fset.Position(group[0].Pos()), path, d.Strategy})
+				continue
+			}
+		} else {
+			keepIdx = keepStrategy.Choose(group)
+		}
+		if keepIdx < 0 || keepIdx >= len(v) {
+			panicf("strategy %s chose index %d for group of length %d", d.Strategy, keepIdx, len(v))
+		}
+
+		if pins == 0 && pathIdx == -1 && d.Strategy == "unnamed" && d.PreferExplicit && v[keepIdx].spec.Name == nil {
+			// If we would have to guess the unnamed import's package
+			// name, prefer the first named import, whose name is
+			// known to be correct.
+			path, _ := normalizeImportPath(v[keepIdx].spec.Path.Value)
+			if _, guessed := d.lookupPackageName(path, srcDir); guessed {
+				for i := range v {
+					if v[i].spec.Name != nil {
+						keepIdx = i
+						decidedBy = "prefer-explicit"
+						break
+					}
+				}
+			}
+		}
+
+		// A blank import can't replace a regular import: the package's
+		// exported names would no longer be usable in the file, even though
+		// its init would still run.
+		if name := v[keepIdx].spec.Name; name != nil && name.Name == "_" {
+			panicf("[code bug] blank import chosen to replace regular imports")
+		}
+
+		// mark imports for removal
+		for i := 0; i < len(v); i++ {
+			if i != keepIdx {
+				v[i].remove = true
+				v[i].subsumedBy = v[keepIdx].spec
+				v[i].decidedBy = decidedBy
+			}
+		}
+	}
+
+	// Dot imports of the same path are redundant: each brings the same names
+	// into the file scope, so there are no selectors to rewrite. Keep the
+	// first.
+	for p, dots := range dotPaths {
+		if d.filteredOut(p, srcDir) {
+			continue
+		}
+		for _, im := range dots[1:] {
+			im.remove = true
+			im.subsumedBy = dots[0].spec
+			im.decidedBy = "dot"
+		}
+	}
+
+	// Blank imports of a path without other imports are redundant after the
+	// first, since one import runs the package's init. Keep the first. With
+	// other imports of the path, the blank imports are left alone, unless
+	// Options.CollapseBlank is set, below.
+	for p, blanks := range blankPaths {
+		if len(blanks) < 2 || len(importPaths[p]) != 0 || len(dotPaths[p]) != 0 || d.filteredOut(p, srcDir) {
+			continue
+		}
+		for _, im := range blanks[1:] {
+			im.remove = true
+			im.subsumedBy = blanks[0].spec
+			im.decidedBy = "blank"
+		}
+	}
+
+	if d.CollapseBlank {
+		// A blank import is redundant if a regular import of the same path
+		// exists, since the regular import runs the package's init too.
+		for p, blanks := range blankPaths {
+			if d.filteredOut(p, srcDir) {
+				continue
+			}
+			var kept *ast.ImportSpec
+			for _, im := range importPaths[p] {
+				if !im.remove {
+					kept = im.spec
+					break
+				}
+			}
+			if kept == nil {
+				continue
+			}
+			for _, im := range blanks {
+				im.remove = true
+				im.subsumedBy = kept
+				im.decidedBy = "collapse-blank"
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		// groups were found by ranging over a map.
+		sort.Stable(byPosition(errs))
+		return nil, errs
+	}
+	return imports, nil
+}
+
+// filteredOut reports whether the duplicate imports of the path are left
+// alone because the package name doesn't match Options.NameFilter.
+func (d *deduper) filteredOut(path, srcDir string) bool {
+	return d.NameFilter != nil && !d.NameFilter.MatchString(d.packageNameForPath(path, srcDir))
+}
+
+// matchPath returns the index of the first spec in the group whose path, as
+// written in the source, matches Options.KeepPathRegexp, or -1 if none does.
+func (d *deduper) matchPath(group []*ast.ImportSpec) int {
+	if d.KeepPathRegexp == nil {
+		return -1
+	}
+	for i, spec := range group {
+		if d.KeepPathRegexp.MatchString(writtenPath(spec, d.writtenPaths)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// writtenPath returns the spec's import path as written in the source: its
+// entry in written, if any, or else its normalized path.
+func writtenPath(spec *ast.ImportSpec, written map[*ast.ImportSpec]string) string {
+	if path, ok := written[spec]; ok {
+		return path
+	}
+	path, _ := normalizeImportPath(spec.Path.Value)
+	return path
+}
+
+// selectorUses returns the number of selector expressions in the file, like
+// "pkg.Foo", by the name of the identifier on the left. It doesn't account for
+// local declarations that shadow imports.
+func selectorUses(file *ast.File) map[string]int {
+	uses := make(map[string]int)
+	ast.Inspect(file, func(node ast.Node) bool {
+		if x, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := selectorIdent(x); ok {
+				uses[ident.Name]++
+			}
+		}
+		return true
+	})
+	return uses
+}
+
+// selectorIdent returns the identifier on the left of the selector
+// expression, unwrapping parentheses, as in "(pkg).Foo".
+func selectorIdent(x *ast.SelectorExpr) (*ast.Ident, bool) {
+	expr := x.X
+	for {
+		paren, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = paren.X
+	}
+	ident, ok := expr.(*ast.Ident)
+	return ident, ok
+}
+
+// isBadImportPath reports whether the import path is one from which no
+// package name can be determined, such as "", ".", or "/". go/parser accepts
+// such paths, but the go command rejects them; imports with these paths are
+// never considered duplicates.
+func isBadImportPath(p string) bool {
+	return strings.Trim(p, "./") == ""
+}
+
+// badImportPathWarnings returns a warning for each import in the file with
+// a bad import path.
+func badImportPathWarnings(fset *token.FileSet, specs []*ast.ImportSpec) []string {
+	var warnings []string
+	for _, spec := range specs {
+		if path, err := normalizeImportPath(spec.Path.Value); err == nil && isBadImportPath(path) {
+			warnings = append(warnings, fmt.Sprintf("%s: skipping import with invalid path %s", fset.Position(spec.Pos()), spec.Path.Value))
+		}
+	}
+	return warnings
+}
+
+// importName returns the name of the import spec, or "" if it is unnamed.
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name == nil {
+		return ""
+	}
+	return spec.Name.Name
+}
+
+// distinctAliasWarnings returns a warning for each kept import that has the
+// same path as an earlier kept import but a different name. Such imports are
+// preserved with Options.DistinctAliases.
+func distinctAliasWarnings(fset *token.FileSet, imports []*importSpec) []string {
+	var warnings []string
+	first := make(map[string]*ast.ImportSpec) // by path
+	for _, im := range imports {
+		name := importName(im.spec)
+		if im.remove || name == "_" || name == "." {
+			continue
+		}
+		path, _ := normalizeImportPath(im.spec.Path.Value)
+		other, ok := first[path]
+		if !ok {
+			first[path] = im.spec
+			continue
+		}
+		if name != importName(other) {
+			warnings = append(warnings, fmt.Sprintf("%s: keeping import of %q: name differs from import on line %d",
+				fset.Position(im.spec.Pos()), path, fset.Position(other.Pos()).Line))
+		}
+	}
+	return warnings
+}
+
+type importSpec struct {
+	spec       *ast.ImportSpec // this spec
+	remove     bool            // indicator for removal
+	subsumedBy *ast.ImportSpec // the spec replacing this spec; nil if remove==false
+	decidedBy  string          // what chose subsumedBy; see SpecInfo.Strategy
+}
+
+func panicf(format string, v ...interface{}) {
+	s := fmt.Sprintf(format, v...)
+	panic(s)
+}
+
+// formatFile formats the file in the same way as gofmt, unless
+// Options.TabWidth or Options.UseSpaces specify otherwise. If the file
+// contains the order sentinel comment, the order of the imports is left
+// untouched; format.Node would otherwise sort them.
+func (d *deduper) formatFile(fset *token.FileSet, file *ast.File) ([]byte, error) {
+	var buf bytes.Buffer
+	keepOrder := d.hasOrderSentinel(file)
+	if !keepOrder && d.TabWidth == 8 && !d.UseSpaces {
+		if err := format.Node(&buf, fset, file); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	if !keepOrder {
+		ast.SortImports(fset, file)
+	}
+	// Same as the config used by format.Node, other than the flags.
+	config := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: d.TabWidth}
+	if d.UseSpaces {
+		config.Mode = printer.UseSpaces
+	}
+	if err := config.Fprint(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// hasOrderSentinel reports whether the file has a comment that begins with
+// the order sentinel specified using Options.OrderSentinel.
+func (d *deduper) hasOrderSentinel(file *ast.File) bool {
+	if d.OrderSentinel == "" {
+		return false
+	}
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			if strings.HasPrefix(c.Text, d.OrderSentinel) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,493 @@
+package dedup
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestProcess(t *testing.T) {
+	src := `package pkg
+
+import (
+	"strings"
+	str "strings"
+)
+
+var _ = str.ToLower
+`
+	want := `package pkg
+
+import (
+	"strings"
+)
+
+var _ = strings.ToLower
+`
+	out, err := Process([]byte(src), "process.go", Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(out) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out)
+	}
+
+	// A file without duplicates is returned as is.
+	src = "package pkg\n\nimport \"fmt\"\n\nvar _ = fmt.Println\n"
+	out, err = Process([]byte(src), "process.go", Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(out) != src {
+		t.Errorf("expected unchanged source, got:\n%s", out)
+	}
+
+	if _, err := Process([]byte(src), "process.go", Options{Strategy: "nonexistent"}); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
+
+func TestProcessScopeError(t *testing.T) {
+	src, err := ioutil.ReadFile("../testdata/scope1.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Process(src, "../testdata/scope1.go", Options{})
+	if _, ok := err.(MultiError); !ok {
+		t.Fatalf("expected MultiError, got %T", err)
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	src := `package pkg
+
+import (
+	"strings"
+	s "strings"
+	"fmt"
+)
+
+var _ = s.ToLower
+var _ = fmt.Println
+`
+	fset := token.NewFileSet()
+	for _, tt := range []struct {
+		strategy string
+		line     int
+		keptLine int
+	}{
+		{"unnamed", 5, 4},
+		{"named", 4, 5},
+	} {
+		dups, err := Duplicates(fset, []byte(src), "dups.go", Options{Strategy: tt.strategy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dups) != 1 {
+			t.Fatalf("%s: expected 1 duplicate, got %d", tt.strategy, len(dups))
+		}
+		if d := dups[0]; d.Path != "strings" || d.Position.Line != tt.line || d.KeptPosition.Line != tt.keptLine {
+			t.Errorf("%s: unexpected duplicate %+v", tt.strategy, d)
+		}
+	}
+}
+
+// Duplicates reports the imports that ProcessFile removes, with the options
+// that affect which ones it removes.
+func TestDuplicatesOptions(t *testing.T) {
+	src := `package pkg
+
+import (
+	"strings"
+	s "strings"
+	"fmt"
+	f "fmt"
+)
+
+// The f import is kept for [f.Println].
+func a() {
+	s.ToLower("")
+	f.Println()
+}
+`
+	for _, tt := range []struct {
+		name string
+		src  string
+		opts Options
+		want int // -1 for an error
+	}{
+		{"default", src, Options{}, 2},
+		{"doc-referenced", src, Options{KeepDocReferenced: true}, 1},
+		{"region", src, Options{Region: Region{Start: 0, End: strings.LastIndex(src, "f.Println"), set: true}}, 1},
+		{"imports-only-parse", "package pkg\n\nimport (\n\t\"fmt\"\n\t\"fmt\"\n)\n\nfunc {\n", Options{ImportsOnlyParse: true}, 1},
+		{"conflict", src + "\nfunc b(strings int) { s.ToUpper(\"\") }\n", Options{}, -1},
+		{"conflict-partial", src + "\nfunc b(strings int) { s.ToUpper(\"\") }\n", Options{OnConflict: "partial"}, 1},
+	} {
+		result, perr := ProcessFile(token.NewFileSet(), []byte(tt.src), "opts.go", tt.opts)
+		dups, derr := Duplicates(token.NewFileSet(), []byte(tt.src), "opts.go", tt.opts)
+		if (perr == nil) != (derr == nil) {
+			t.Errorf("%s: ProcessFile error %v, Duplicates error %v", tt.name, perr, derr)
+			continue
+		}
+		if perr != nil {
+			if tt.want != -1 {
+				t.Errorf("%s: unexpected error: %s", tt.name, perr)
+			}
+			continue
+		}
+		if len(dups) != tt.want || len(result.RemovedSpecs) != tt.want {
+			t.Errorf("%s: expected %d duplicates, got %d from Duplicates and %d from ProcessFile", tt.name, tt.want, len(dups), len(result.RemovedSpecs))
+		}
+	}
+}
+
+// With Options.Strict, no strategy reports duplicates with the same import
+// name as ambiguous, since keeping any of them results in the same file.
+func TestStrictIdentical(t *testing.T) {
+	for _, imports := range []string{
+		"\"fmt\"\n\t\"fmt\"",
+		"f \"fmt\"\n\tf \"fmt\"",
+		"f \"fmt\" // one\n\tf \"fmt\" // two",
+	} {
+		src := "package pkg\n\nimport (\n\t" + imports + "\n)\n"
+		for _, strategy := range StrategyNames() {
+			if _, err := Process([]byte(src), "strict.go", Options{Strategy: strategy, Strict: true}); err != nil {
+				t.Errorf("%s: %s: unexpected error: %s", strategy, imports, err)
+			}
+		}
+	}
+}
+
+func TestGuessPackageName(t *testing.T) {
+	type testcase struct {
+		importPath string
+		expect     string
+	}
+	testcases := []testcase{
+		{"github.com/foo/bar", "bar"},
+		{"github.com/foo/bar/v2", "bar"},
+		{"github.com/foo/go-bar/v2", "bar"},
+		{"github.com/foo/bar-go/v2", "bar"},
+		{"gopkg.in/yaml.v2", "yaml"},
+		{"gopkg.in/go-yaml.v2", "yaml"},
+		{"gopkg.in/yaml-go.v2", "yaml"},
+		{"github.com/nishanths/go-xkcd", "xkcd"},
+		{"github.com/nishanths/lyft-go", "lyft"},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.importPath, func(t *testing.T) {
+			got := GuessPackageName(tt.importPath)
+			if tt.expect != got {
+				t.Errorf("expected: %s, got: %s", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestRegisterStrategy(t *testing.T) {
+	// keep the last import.
+	RegisterStrategy("test-last", KeepStrategyFunc(func(group []*ast.ImportSpec) int {
+		return len(group) - 1
+	}))
+	defer delete(strategies, "test-last")
+
+	src := `package pkg
+
+import (
+	"strings"
+	s "strings"
+	str "strings"
+)
+
+var _ = strings.Title
+var _ = s.ToLower
+`
+	want := `package pkg
+
+import (
+	str "strings"
+)
+
+var _ = str.Title
+var _ = str.ToLower
+`
+	out, err := Process([]byte(src), "custom.go", Options{Strategy: "test-last"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(out) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out)
+	}
+}
+
+// A blank import must never be what remains of a regular import. The regular
+// import triggers the package's init as well, but removing it would lose the
+// package's exported names.
+func TestBlankNeverReplacesRegular(t *testing.T) {
+	src := `package pkg
+
+import (
+	_ "strings"
+	"strings"
+	s "strings"
+	_ "strings"
+)
+`
+	for _, name := range StrategyNames() {
+		t.Run(name, func(t *testing.T) {
+			d, err := newDeduper(Options{Strategy: name})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "blank.go", src, parser.ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			imports, err := d.markDuplicates(fset, file.Imports, ".", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			regular := 0
+			for _, im := range imports {
+				if im.spec.Name != nil && im.spec.Name.Name == "_" {
+					continue
+				}
+				if !im.remove {
+					regular++
+				} else if im.subsumedBy.Name != nil && im.subsumedBy.Name.Name == "_" {
+					t.Errorf("regular import %s replaced by blank import", im.spec.Path.Value)
+				}
+			}
+			if regular != 1 {
+				t.Errorf("expected 1 regular import to remain, got %d", regular)
+			}
+		})
+	}
+}
+
+func TestRegionSet(t *testing.T) {
+	testcases := []struct {
+		val        string
+		start, end int
+		err        bool
+	}{
+		{"0:10", 0, 10, false},
+		{"5:5", 5, 5, false},
+		{"10:5", 0, 0, true},
+		{"-1:5", 0, 0, true},
+		{"5", 0, 0, true},
+		{"a:b", 0, 0, true},
+	}
+	for _, tt := range testcases {
+		var r Region
+		err := r.Set(tt.val)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: unexpected error: %v", tt.val, err)
+			continue
+		}
+		if err == nil && (r.Start != tt.start || r.End != tt.end) {
+			t.Errorf("%s: expected %d:%d, got %d:%d", tt.val, tt.start, tt.end, r.Start, r.End)
+		}
+	}
+}
+
+func TestKeepShortestPath(t *testing.T) {
+	spec := func(path string) *ast.ImportSpec {
+		return &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)}}
+	}
+	testcases := []struct {
+		paths []string
+		idx   int
+		ok    bool
+	}{
+		{[]string{"fmt", "fmt"}, 0, true},
+		{[]string{"example.com/mod/v2/pkg", "example.com/mod/pkg"}, 1, true},
+		{[]string{"example.com/mod/pkg", "example.com/mod/v2/pkg", "example.com/mod/pkg"}, 0, true},
+		{[]string{"example.com/a", "example.com/b"}, 0, false},
+		{[]string{"example.com/abc", "example.com/b", "example.com/c"}, 1, false},
+	}
+	for _, tt := range testcases {
+		var group []*ast.ImportSpec
+		for _, p := range tt.paths {
+			group = append(group, spec(p))
+		}
+		idx, ok := keepShortestPath(group)
+		if idx != tt.idx || ok != tt.ok {
+			t.Errorf("%v: expected (%d, %t), got (%d, %t)", tt.paths, tt.idx, tt.ok, idx, ok)
+		}
+	}
+}
+
+func TestIsBadImportPath(t *testing.T) {
+	for _, p := range []string{"", ".", "..", "/", "./", "../..", "//"} {
+		if !isBadImportPath(p) {
+			t.Errorf("expected %q to be bad", p)
+		}
+	}
+	for _, p := range []string{"fmt", "./x", "../x", "/abs", "example.com/a.b"} {
+		if isBadImportPath(p) {
+			t.Errorf("expected %q to not be bad", p)
+		}
+	}
+}
+
+func TestResolver(t *testing.T) {
+	// The guessed name, "yaml", would be wrong: the package is named
+	// "goyaml".
+	src := `package pkg
+
+import (
+	"example.com/go-yaml.v3"
+	y "example.com/go-yaml.v3"
+)
+
+var _ = goyaml.Marshal
+var _ = y.Unmarshal
+`
+	want := `package pkg
+
+import (
+	"example.com/go-yaml.v3"
+)
+
+var _ = goyaml.Marshal
+var _ = goyaml.Unmarshal
+`
+	resolver := func(p, srcDir string) (string, bool) {
+		if p == "example.com/go-yaml.v3" {
+			return "goyaml", true
+		}
+		return "", false
+	}
+	out, err := Process([]byte(src), "resolver.go", Options{Resolver: resolver})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(out) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out)
+	}
+
+	name, source := ResolvePackageName("example.com/go-yaml.v3", ".", Options{Resolver: resolver})
+	if name != "goyaml" || source != SourceResolver {
+		t.Errorf("expected goyaml (resolver), got %s (%s)", name, source)
+	}
+	name, source = ResolvePackageName("example.com/other", ".", Options{Resolver: resolver})
+	if name != "other" || source != SourceGuessed {
+		t.Errorf("expected other (guessed), got %s (%s)", name, source)
+	}
+}
+
+func TestDuplicatesQuoteStyles(t *testing.T) {
+	src := "package pkg\n\nimport (\n\t`fmt`\n\tf \"fmt\"\n)\n\nvar _ = f.Println\n"
+	dups, err := Duplicates(token.NewFileSet(), []byte(src), "quotes.go", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dups) != 1 || dups[0].Path != "fmt" || dups[0].Name != "f" || dups[0].KeptPosition.Line != 4 {
+		t.Fatalf("expected raw and interpreted string paths in one group, got %+v", dups)
+	}
+
+	out, err := Process([]byte(src), "quotes.go", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "package pkg\n\nimport (\n\t\"fmt\"\n)\n\nvar _ = fmt.Println\n"
+	if string(out) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out)
+	}
+}
+
+func TestDumpAST(t *testing.T) {
+	src := []byte(`package pkg
+
+import (
+	"strings"
+	str "strings"
+)
+
+var _ = str.ToLower
+`)
+	plain, err := ProcessFile(token.NewFileSet(), src, "dump.go", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain.AST != nil {
+		t.Errorf("expected no AST without DumpAST, got:\n%s", plain.AST)
+	}
+
+	dumped, err := ProcessFile(token.NewFileSet(), src, "dump.go", Options{DumpAST: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dumped.Output, plain.Output) {
+		t.Errorf("expected the same output with DumpAST, got:\n%s", dumped.Output)
+	}
+	for _, want := range []string{"*ast.File", "*ast.ImportSpec", `Name: "strings"`} {
+		if !bytes.Contains(dumped.AST, []byte(want)) {
+			t.Errorf("expected AST to contain %s, got:\n%s", want, dumped.AST)
+		}
+	}
+	if bytes.Contains(dumped.AST, []byte(`Name: "str"`)) {
+		t.Error("expected AST after rewriting, with no references to str")
+	}
+}
+
+// No source that go/parser accepts makes the package panic.
+func TestUnusualImportPaths(t *testing.T) {
+	paths := []string{
+		`""`, `"."`, `"/"`, `"//"`, `"..."`, `"./a"`, `"../a"`, `"a/"`, `"a//b"`,
+		"`fmt`", `"\x66mt"`, `"a b"`, `"a\tb"`, `"\x00"`, `"é"`, `"π/v2"`,
+		`"v2"`, `".v1"`, `"a.v1"`, `"go-"`, `"-go"`, `"-"`, `"_"`, `"1a"`,
+		`"\\"`, `"\""`, `"C"`,
+	}
+	for _, p := range paths {
+		for _, name := range []string{"", "x ", "_ ", ". "} {
+			src := "package pkg\n\nimport (\n\t" + name + p + "\n\t" + p + "\n\ty " + p + "\n)\n\nvar _ = y.Z\n"
+			if _, err := parser.ParseFile(token.NewFileSet(), "unusual.go", src, 0); err != nil {
+				continue
+			}
+			for _, strategy := range StrategyNames() {
+				for _, opts := range []Options{
+					{Strategy: strategy},
+					{Strategy: strategy, CollapseBlank: true, FixNameCollisions: true},
+					{Strategy: strategy, DistinctAliases: true, OnConflict: "partial"},
+					{Strategy: strategy, ImportsOnlyParse: true},
+				} {
+					_, err := ProcessFile(token.NewFileSet(), []byte(src), "unusual.go", opts)
+					if _, ok := err.(*InternalError); ok {
+						t.Errorf("%s: %s", src, err)
+					}
+					_, err = Duplicates(token.NewFileSet(), []byte(src), "unusual.go", opts)
+					if _, ok := err.(*InternalError); ok {
+						t.Errorf("%s: %s", src, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestInternalError(t *testing.T) {
+	// a strategy that chooses an index out of range.
+	RegisterStrategy("test-bad-index", KeepStrategyFunc(func(group []*ast.ImportSpec) int {
+		return len(group)
+	}))
+	defer delete(strategies, "test-bad-index")
+
+	src := []byte("package pkg\n\nimport (\n\t\"fmt\"\n\tf \"fmt\"\n)\n")
+	_, err := ProcessFile(token.NewFileSet(), src, "bad.go", Options{Strategy: "test-bad-index"})
+	if _, ok := err.(*InternalError); !ok {
+		t.Errorf("expected *InternalError, got: %v", err)
+	}
+	_, err = Duplicates(token.NewFileSet(), src, "bad.go", Options{Strategy: "test-bad-index"})
+	if _, ok := err.(*InternalError); !ok {
+		t.Errorf("expected *InternalError, got: %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package dedup
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"sort"
+)
+
+type InvalidIdentError struct {
+	position token.Position
+	from, to string
+}
+
+var _ error = (*InvalidIdentError)(nil)
+
+func (s *InvalidIdentError) pos() token.Position     { return s.position }
+func (s *InvalidIdentError) names() (string, string) { return s.from, s.to }
+
+func (s *InvalidIdentError) Error() string {
+	return fmt.Sprintf("%s: cannot rewrite %s -> %s: identifier %[3]s is not a valid identifier; "+
+		"specify a mapping for the import using '-m'", s.position, s.from, s.to)
+}
+
+type GoKeywordError struct {
+	position token.Position
+	from, to string
+}
+
+var _ error = (*GoKeywordError)(nil)
+
+func (s *GoKeywordError) pos() token.Position     { return s.position }
+func (s *GoKeywordError) names() (string, string) { return s.from, s.to }
+
+func (s *GoKeywordError) Error() string {
+	return fmt.Sprintf("%s: cannot rewrite %s -> %s: identifier %[3]s is a go keyword; "+
+		"specify a mapping for the import using '-m'", s.position, s.from, s.to)
+}
+
+type ScopeError struct {
+	position token.Position
+	from, to string
+}
+
+var _ error = (*ScopeError)(nil)
+
+func (s *ScopeError) pos() token.Position     { return s.position }
+func (s *ScopeError) names() (string, string) { return s.from, s.to }
+
+func (s *ScopeError) Error() string {
+	return fmt.Sprintf("%s: cannot rewrite %s -> %s: identifier %[3]s in scope might not be referring to the import",
+		s.position, s.from, s.to)
+}
+
+type InitNameError struct {
+	position token.Position
+	from     string
+}
+
+var _ error = (*InitNameError)(nil)
+
+func (s *InitNameError) pos() token.Position     { return s.position }
+func (s *InitNameError) names() (string, string) { return s.from, "init" }
+
+func (s *InitNameError) Error() string {
+	return fmt.Sprintf("%s: cannot rewrite %s -> init: a package cannot be imported as init; "+
+		"keep a different import using '-keep'", s.position, s.from)
+}
+
+type NameCollisionError struct {
+	position  token.Position
+	name      string
+	path      string
+	otherLine int
+	unfixable bool // with Options.FixNameCollisions, no selector would use an alias
+}
+
+var _ error = (*NameCollisionError)(nil)
+
+func (n *NameCollisionError) pos() token.Position { return n.position }
+
+func (n *NameCollisionError) Error() string {
+	if n.unfixable {
+		return fmt.Sprintf("%s: package name %s of import %s collides with import on line %d; "+
+			"alias one of the imports (no references would use an alias added by '-fix-name-collisions')", n.position, n.name, n.path, n.otherLine)
+	}
+	return fmt.Sprintf("%s: package name %s of import %s collides with import on line %d; "+
+		"alias one of the imports, or use '-fix-name-collisions'", n.position, n.name, n.path, n.otherLine)
+}
+
+type PinError struct {
+	position token.Position
+	path     string
+	marker   string
+}
+
+var _ error = (*PinError)(nil)
+
+func (p *PinError) pos() token.Position { return p.position }
+
+func (p *PinError) Error() string {
+	return fmt.Sprintf("%s: cannot choose import of %q to keep: multiple duplicates are pinned with %q",
+		p.position, p.path, p.marker)
+}
+
+type AmbiguousError struct {
+	position token.Position
+	path     string
+	strategy string
+}
+
+var _ error = (*AmbiguousError)(nil)
+
+func (a *AmbiguousError) pos() token.Position { return a.position }
+
+func (a *AmbiguousError) Error() string {
+	return fmt.Sprintf("%s: cannot choose import of %q to keep: strategy %s is ambiguous for these duplicates",
+		a.position, a.path, a.strategy)
+}
+
+// InternalError is returned by ProcessFile and Duplicates instead of
+// panicking if processing a file fails unexpectedly. It indicates a bug in
+// the package or in a registered KeepStrategy, not a problem with the file.
+type InternalError struct {
+	filename string
+	value    interface{} // the value passed to panic
+}
+
+var _ error = (*InternalError)(nil)
+
+func (e *InternalError) Error() string {
+	return fmt.Sprintf("%s: internal error: %v", e.filename, e.value)
+}
+
+// recoverInternal sets *err to an InternalError if the calling function is
+// panicking. It must be deferred directly.
+func recoverInternal(filename string, err *error) {
+	if r := recover(); r != nil {
+		*err = &InternalError{filename, r}
+	}
+}
+
+// positionError is an error that occurred at a position in a file.
+type positionError interface {
+	error
+	pos() token.Position
+}
+
+// byPosition sorts errors by position. Errors without a position sort
+// after those with one.
+type byPosition []error
+
+func (b byPosition) Len() int      { return len(b) }
+func (b byPosition) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byPosition) Less(i, j int) bool {
+	pi, iok := b[i].(positionError)
+	pj, jok := b[j].(positionError)
+	if !iok || !jok {
+		return iok && !jok
+	}
+	if pi.pos().Filename != pj.pos().Filename {
+		return pi.pos().Filename < pj.pos().Filename
+	}
+	return pi.pos().Offset < pj.pos().Offset
+}
+
+// rewriteError is an error for a selector expression that could not be
+// rewritten.
+type rewriteError interface {
+	positionError
+	names() (from, to string)
+}
+
+var (
+	_ rewriteError = (*InvalidIdentError)(nil)
+	_ rewriteError = (*GoKeywordError)(nil)
+	_ rewriteError = (*ScopeError)(nil)
+	_ rewriteError = (*InitNameError)(nil)
+)
+
+// omittedErrors is the number of rewrite errors omitted from a file's errors
+// due to Options.MaxErrors.
+type omittedErrors int
+
+func (n omittedErrors) Error() string {
+	return fmt.Sprintf("(and %d more)", int(n))
+}
+
+type MultiError []error
+
+var _ error = (MultiError)(nil)
+
+// Error returns the errors, sorted by position, one per line.
+func (m MultiError) Error() string {
+	if len(m) == 0 {
+		panic("[code bug] MultiError has zero errors") // don't make such a MultiError in the first place.
+	}
+	sorted := make([]error, len(m))
+	copy(sorted, m)
+	sort.Stable(byPosition(sorted))
+	var buf bytes.Buffer
+	for i, e := range sorted {
+		buf.WriteString(e.Error())
+		if i != len(m)-1 {
+			buf.WriteString("\n")
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,120 @@
+package dedup
+
+import (
+	"go/ast"
+	"go/token"
+	"unicode/utf8"
+)
+
+// TextEdit is a text edit in the Language Server Protocol format.
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// Range is a range in a file in the Language Server Protocol format. The end
+// is exclusive.
+type Range struct {
+	Start LSPPosition `json:"start"`
+	End   LSPPosition `json:"end"`
+}
+
+// LSPPosition is a position in a file in the Language Server Protocol format.
+// Line and Character are 0-based, and Character is in UTF-16 code units.
+type LSPPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// lspPosition converts the byte offset in src to an LSPPosition.
+func lspPosition(src []byte, offset int) LSPPosition {
+	var p LSPPosition
+	for i := 0; i < offset; {
+		r, size := utf8.DecodeRune(src[i:])
+		i += size
+		switch {
+		case r == '\n':
+			p.Line++
+			p.Character = 0
+		case r >= 0x10000:
+			p.Character += 2 // surrogate pair
+		default:
+			p.Character++
+		}
+	}
+	return p
+}
+
+// removalEdits returns the edits that remove the specs in the file's import
+// declarations for which remove returns true, along with their comments. An
+// import declaration whose specs are all removed is removed entirely. It must
+// be called before the file's AST or positions are updated.
+func removalEdits(fset *token.FileSet, file *ast.File, src []byte, remove func(*ast.ImportSpec) bool) []TextEdit {
+	var edits []TextEdit
+	for _, d := range file.Decls {
+		d, ok := d.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT || len(d.Specs) == 0 {
+			continue
+		}
+		var removed []*ast.ImportSpec
+		for _, s := range d.Specs {
+			if s := s.(*ast.ImportSpec); remove(s) {
+				removed = append(removed, s)
+			}
+		}
+		if len(removed) == len(d.Specs) {
+			start := d.Pos()
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+			edits = append(edits, deleteEdit(fset, src, start, d.End()))
+			continue
+		}
+		for _, s := range removed {
+			start, end := s.Pos(), s.End()
+			if s.Doc != nil {
+				start = s.Doc.Pos()
+			}
+			if s.Comment != nil {
+				end = s.Comment.End()
+			}
+			edits = append(edits, deleteEdit(fset, src, start, end))
+		}
+	}
+	return edits
+}
+
+// deleteEdit returns an edit that deletes the text from start to end. If the
+// text is alone on its lines, the lines are deleted entirely.
+func deleteEdit(fset *token.FileSet, src []byte, start, end token.Pos) TextEdit {
+	s, e := fset.Position(start).Offset, fset.Position(end).Offset
+	ls := s
+	for ls > 0 && (src[ls-1] == ' ' || src[ls-1] == '\t') {
+		ls--
+	}
+	le := e
+	for le < len(src) && (src[le] == ' ' || src[le] == '\t' || src[le] == '\r') {
+		le++
+	}
+	if (ls == 0 || src[ls-1] == '\n') && (le == len(src) || src[le] == '\n') {
+		s = ls
+		e = le
+		if e < len(src) {
+			e++ // the newline
+		}
+	}
+	return TextEdit{Range{lspPosition(src, s), lspPosition(src, e)}, ""}
+}
+
+// renameEdits returns the edits that rename the package identifiers of the
+// rewritten selector expressions.
+func renameEdits(src []byte, rewrites []RewriteInfo) []TextEdit {
+	var edits []TextEdit
+	for _, r := range rewrites {
+		edits = append(edits, TextEdit{
+			Range{lspPosition(src, r.Position.Offset), lspPosition(src, r.Position.Offset+len(r.From))},
+			r.To,
+		})
+	}
+	return edits
+}
@@ -0,0 +1,175 @@
+package dedup
+
+import (
+	"go/ast"
+	"go/build"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func normalizeImportPath(p string) (string, error) {
+	return strconv.Unquote(p)
+}
+
+func (d *deduper) packageNameForImport(spec *ast.ImportSpec, srcDir string) string {
+	if spec.Name != nil {
+		// named import
+		return spec.Name.Name
+	}
+	path, err := normalizeImportPath(spec.Path.Value)
+	if err != nil {
+		// wasn't a valid string?
+		panicf("unquoting path: %s", err)
+	}
+	return d.packageNameForPath(path, srcDir)
+}
+
+func (d *deduper) packageNameForPath(p string, srcDir string) string {
+	name, _ := d.lookupPackageName(p, srcDir)
+	return name
+}
+
+// lookupPackageName returns the package name for the import path. guessed
+// is true if the name was derived from the import path by GuessPackageName,
+// and so might be incorrect.
+func (d *deduper) lookupPackageName(p string, srcDir string) (name string, guessed bool) {
+	name, source := d.resolvePackageName(p, srcDir)
+	return name, source == SourceGuessed
+}
+
+// The sources of a package name, as returned by ResolvePackageName.
+const (
+	SourceMapping  = "mapping"  // from Options.PackageNames
+	SourceResolver = "resolver" // from Options.Resolver
+	SourceResolved = "resolved" // from the package's source files, via go/build
+	SourceGuessed  = "guessed"  // from the import path, via GuessPackageName
+)
+
+// ResolvePackageName returns the package name used for the import path p by
+// a file in srcDir, and the source of the name: SourceMapping,
+// SourceResolver, SourceResolved, or SourceGuessed. Only opts.PackageNames
+// and opts.Resolver are used.
+func ResolvePackageName(p, srcDir string, opts Options) (name, source string) {
+	d := &deduper{Options: opts.withDefaults()}
+	return d.resolvePackageName(p, srcDir)
+}
+
+// resolvePackageName returns the package name for the import path and the
+// source of the name.
+func (d *deduper) resolvePackageName(p string, srcDir string) (name, source string) {
+	// Use the mapping first.
+	if name, ok := d.PackageNames[p]; ok {
+		return name, SourceMapping
+	}
+	if d.Resolver != nil {
+		if name, ok := d.Resolver(p, srcDir); ok {
+			return name, SourceResolver
+		}
+	}
+	// Try build.Import. Ignore the error; pkg could be non-nil
+	// with sufficient information we care about regardless of the error.
+	pkg, _ := build.Import(p, srcDir, build.AllowBinary|build.ImportComment)
+	if pkg != nil && pkg.Name != "" {
+		return pkg.Name, SourceResolved
+	}
+	// Guess it.
+	return GuessPackageName(p), SourceGuessed
+}
+
+// GuessPackageName guesses the package name based on the import path.
+// The returned string may not be a valid identifier (and hence not a valid
+// package name).
+func GuessPackageName(p string) string {
+	// as an example, this can do:
+	// "foo.org/blah/go-yaml.v2" -> "yaml"
+	return guessPackageName_(p, true)
+}
+
+var (
+	modulevn = regexp.MustCompile(`^v\d+$`)
+	dotvn    = regexp.MustCompile(`\.v\d+$`)
+)
+
+func guessPackageName_(p string, trimVersion bool) string {
+	sidx := strings.LastIndex(p, "/")
+	if sidx == -1 {
+		return p
+	}
+
+	last := p[sidx+1:]
+
+	// Order matters.
+	switch {
+	case trimVersion && modulevn.MatchString(last):
+		// foo.org/blah/go-yaml/v2
+		idx := strings.LastIndex(p, "/")
+		if idx == -1 {
+			panicf("[code bug] should have '/' in string: %s", p)
+		}
+		return guessPackageName_(p[:idx], false)
+	case trimVersion && dotvn.MatchString(last):
+		// foo.org/blah/go-yaml.v2
+		idx := strings.LastIndex(p, ".")
+		if idx == -1 {
+			panicf("[code bug] should have '.' in string: %s", p)
+		}
+		return guessPackageName_(p[:idx], false)
+	case strings.HasPrefix(last, "go-"):
+		// foo.org/go-yaml
+		return strings.TrimPrefix(last, "go-")
+	case strings.HasSuffix(last, "-go"):
+		// foo.org/yaml-go
+		return strings.TrimSuffix(last, "-go")
+	default:
+		return last
+	}
+}
+
+// canonicalizePaths rewrites the paths of the imports of modules in the
+// Options.Canonicalize mappings, and their packages, to the paths of the
+// mapped major versions. For example, with "example.com/foo=v2", the import path
+// "example.com/foo/bar" becomes "example.com/foo/v2/bar". Paths already of
+// a major version, such as "example.com/foo/v3", are left alone. If bases
+// overlap, the longest that matches is used. It reports whether any path was
+// rewritten, and records the paths as written in d.writtenPaths.
+func (d *deduper) canonicalizePaths(specs []*ast.ImportSpec) bool {
+	var bases []string
+	for base := range d.Canonicalize {
+		bases = append(bases, base)
+	}
+	sort.Slice(bases, func(i, j int) bool {
+		if len(bases[i]) != len(bases[j]) {
+			return len(bases[i]) > len(bases[j])
+		}
+		return bases[i] < bases[j]
+	})
+
+	rewritten := false
+	for _, spec := range specs {
+		path, err := normalizeImportPath(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		for _, base := range bases {
+			if path != base && !strings.HasPrefix(path, base+"/") {
+				continue
+			}
+			v := d.Canonicalize[base]
+			rest := strings.TrimPrefix(path, base)
+			if next := strings.SplitN(strings.TrimPrefix(rest, "/"), "/", 2)[0]; modulevn.MatchString(next) {
+				// already a major version path.
+				break
+			}
+			if d.writtenPaths == nil {
+				d.writtenPaths = make(map[*ast.ImportSpec]string)
+			}
+			d.writtenPaths[spec] = path
+			spec.Path.Value = strconv.Quote(base + "/" + v + rest)
+			rewritten = true
+			break
+		}
+	}
+	return rewritten
+}
@@ -0,0 +1,85 @@
+package dedup
+
+import "go/token"
+
+// Result is the result of processing a file.
+type Result struct {
+	// Changed is whether duplicate imports were removed from the file, or,
+	// with Options.Canonicalize, import paths were rewritten. It is false if
+	// the file had no duplicate imports, or if the file could not be
+	// rewritten (see Conflicts).
+	Changed bool
+	// RemovedSpecs describes the duplicate import specs, which are removed
+	// if Changed is true.
+	RemovedSpecs []SpecInfo
+	// Rewrites describes the selector expressions rewritten to use the
+	// kept imports.
+	Rewrites []RewriteInfo
+	// Conflicts describes the selector expressions that could not be
+	// rewritten. If there are any, the file is left unchanged, unless
+	// OnConflict "partial" is used, in which case the duplicate imports
+	// they refer to are kept.
+	Conflicts []ConflictInfo
+	// Warnings describes issues that don't prevent processing the file.
+	Warnings []string
+	// Edits describes the removals of the duplicate import specs and the
+	// selector rewrites as text edits on the original source, if Changed is
+	// true. It doesn't include other changes, such as the reformatting of
+	// the import declarations or those made by Comments "merge".
+	Edits []TextEdit
+	// Output is the formatted, rewritten file if Changed is true, or the
+	// original source otherwise.
+	Output []byte
+	// AST is the file's AST after all changes, before formatting, as
+	// printed by ast.Fprint, if Options.DumpAST is set and the file was
+	// rewritten.
+	AST []byte
+}
+
+// SpecInfo describes a removed import spec and the spec that replaces it.
+type SpecInfo struct {
+	Position     token.Position // position of the removed spec
+	Name         string         // import name of the removed spec; empty if unnamed
+	Path         string         // import path, unquoted
+	KeptPosition token.Position // position of the kept spec
+	KeptName     string         // import name of the kept spec; empty if unnamed
+
+	// Strategy is what chose the kept spec: the name of the strategy
+	// (Options.Strategy), "pin" for a spec pinned with Options.PinMarker,
+	// "path-regexp" for a spec matching Options.KeepPathRegexp,
+	// "prefer-explicit" for Options.PreferExplicit, "collapse-blank" for
+	// a side-effect import removed with Options.CollapseBlank, or "dot" or
+	// "blank" for a dot or side-effect import removed in favor of an
+	// earlier such import.
+	Strategy string
+}
+
+// RewriteInfo describes a rewritten selector expression.
+type RewriteInfo struct {
+	Position token.Position // position of the package identifier
+	From, To string         // package identifier before and after
+}
+
+// ConflictInfo describes a selector expression that could not be rewritten.
+type ConflictInfo struct {
+	Position token.Position // position of the package identifier
+	From, To string         // package identifier before and the intended identifier after
+	Message  string         // description of the conflict, including the position
+}
+
+func newSpecInfo(fset *token.FileSet, im *importSpec) SpecInfo {
+	path, _ := normalizeImportPath(im.spec.Path.Value)
+	info := SpecInfo{
+		Position:     fset.Position(im.spec.Pos()),
+		Path:         path,
+		KeptPosition: fset.Position(im.subsumedBy.Pos()),
+		Strategy:     im.decidedBy,
+	}
+	if im.spec.Name != nil {
+		info.Name = im.spec.Name.Name
+	}
+	if im.subsumedBy.Name != nil {
+		info.KeptName = im.subsumedBy.Name.Name
+	}
+	return info
+}
@@ -0,0 +1,490 @@
+package dedup
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+type Scope struct {
+	node           ast.Node              // the underlying node that defines this scope (*ast.File, *ast.FuncDecl, *ast.BlockStmt, *ast.FuncLit, *ast.CaseClause, *ast.CommClause, or an if, for, or switch statement)
+	lbrace, rbrace token.Pos             // actual values for *ast.BlockStmt; token.NoPos otherwise
+	outer          *Scope                // parent scope, or nil
+	inner          []*Scope              // immediate inner scopes
+	idents         map[string]*ast.Ident // idents in this scope; the key is the name of the ident for fast lookup
+	starts         map[string]token.Pos  // where the scope of each ident in idents begins, if not at the ident
+	done           bool                  // completed "parsing" this scope; exists to guard against programmer error
+}
+
+func newScope(node ast.Node) *Scope {
+	sc := new(Scope)
+	sc.node = node
+	return sc
+}
+
+func (sc *Scope) assertDone() {
+	if !sc.done {
+		panic("scope not done")
+	}
+}
+
+func (sc *Scope) markDone() {
+	if sc.done {
+		panic("scope already done")
+	}
+	sc.done = true
+}
+
+func (sc *Scope) addIdent(ident *ast.Ident) {
+	if sc.idents == nil {
+		sc.idents = make(map[string]*ast.Ident)
+	}
+	sc.idents[ident.Name] = ident
+	delete(sc.starts, ident.Name)
+}
+
+// addIdentFrom is like addIdent, for an ident whose scope begins at start,
+// such as the end of the declaring statement for a local variable.
+func (sc *Scope) addIdentFrom(ident *ast.Ident, start token.Pos) {
+	sc.addIdent(ident)
+	if sc.starts == nil {
+		sc.starts = make(map[string]token.Pos)
+	}
+	sc.starts[ident.Name] = start
+}
+
+// declared returns the named identifier if such a one
+// is declared in this scope.
+func (sc *Scope) declared(name string) (*ast.Ident, bool) {
+	sc.assertDone()
+	id, ok := sc.idents[name]
+	return id, ok
+}
+
+// available returns the named identifier if such a one is
+// declared in this scope or any of the outer scopes.
+func (sc *Scope) available(name string) (*ast.Ident, bool) {
+	sc.assertDone()
+	for c := sc; c != nil; c = c.outer {
+		if id, ok := c.declared(name); ok {
+			return id, true
+		}
+	}
+	return nil, false
+}
+
+// shadowed reports whether the named identifier is in scope at pos, declared
+// in this scope or any of the outer scopes, not counting the outermost (file)
+// scope. A package name used at pos would then refer to the declared
+// identifier instead of the import. The scope of a local variable begins at
+// the end of its declaration, so that in 's := s.ToUpper("x")', the s on the
+// right isn't shadowed.
+func (sc *Scope) shadowed(name string, pos token.Pos) bool {
+	sc.assertDone()
+	for c := sc; c != nil && c.outer != nil; c = c.outer {
+		id, ok := c.declared(name)
+		if !ok {
+			continue
+		}
+		start, ok := c.starts[name]
+		if !ok {
+			start = id.NamePos
+		}
+		if start < pos {
+			return true
+		}
+	}
+	return false
+}
+
+// each calls fn for each scope inside sc,
+// including sc itself.
+func (sc *Scope) each(fn func(*Scope) bool) {
+	// breadth first traversal.
+	q := []*Scope{sc}
+	for len(q) != 0 {
+		var c *Scope
+		c, q = q[0], q[1:]
+		if !fn(c) {
+			break
+		}
+		for _, in := range c.inner {
+			q = append(q, in)
+		}
+	}
+}
+
+// ScopeJSON is the JSON representation of a Scope, as printed by the
+// command's '-scopes-json' flag.
+type ScopeJSON struct {
+	Kind   string      `json:"kind"`   // "file", "func", "funclit", "block", "if", "for", "switch", or "case"
+	Start  string      `json:"start"`  // position of the start of the scope's node
+	End    string      `json:"end"`    // position of the end of the scope's node
+	Idents []string    `json:"idents"` // names declared in the scope, sorted
+	Inner  []ScopeJSON `json:"inner"`  // immediate inner scopes
+}
+
+// Scopes returns the JSON representation of the scopes in the file, starting
+// with the file scope. Positions are resolved using fset.
+func Scopes(fset *token.FileSet, file *ast.File) ScopeJSON {
+	return walkFile(file).toJSON(fset)
+}
+
+// toJSON returns the JSON representation of sc and its inner scopes.
+func (sc *Scope) toJSON(fset *token.FileSet) ScopeJSON {
+	sc.assertDone()
+	var kind string
+	switch sc.node.(type) {
+	case *ast.File:
+		kind = "file"
+	case *ast.FuncDecl:
+		kind = "func"
+	case *ast.FuncLit:
+		kind = "funclit"
+	case *ast.BlockStmt:
+		kind = "block"
+	case *ast.IfStmt:
+		kind = "if"
+	case *ast.ForStmt:
+		kind = "for"
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt:
+		kind = "switch"
+	case *ast.CaseClause, *ast.CommClause:
+		kind = "case"
+	default:
+		panicf("[code bug] unexpected scope node %T", sc.node)
+	}
+	j := ScopeJSON{
+		Kind:   kind,
+		Start:  fset.Position(sc.node.Pos()).String(),
+		End:    fset.Position(sc.node.End()).String(),
+		Idents: []string{},
+		Inner:  []ScopeJSON{},
+	}
+	for name := range sc.idents {
+		j.Idents = append(j.Idents, name)
+	}
+	sort.Strings(j.Idents)
+	for _, in := range sc.inner {
+		j.Inner = append(j.Inner, in.toJSON(fset))
+	}
+	return j
+}
+
+// Notes
+// -----
+//
+// https://golang.org/ref/spec#Declarations_and_scope
+// Go is lexically scoped using blocks:
+// 1. The scope of a predeclared identifier is the universe block.
+// 2. The scope of an identifier denoting a constant, type, variable, or
+//    function (but not method) declared at top level (outside any function) is
+//    the package block.
+// 3. The scope of the package name of an imported package is the file block
+//    of the file containing the import declaration.
+// 4. The scope of an identifier denoting a method receiver, function
+//    parameter, or result variable is the function body.
+// 5. The scope of a constant or variable identifier declared inside a
+//    function begins at the end of the ConstSpec or VarSpec (ShortVarDecl for
+//    short variable declarations) and ends at the end of the innermost
+//    containing block.
+// 6. The scope of a type identifier declared inside a function begins at the
+//    identifier in the TypeSpec and ends at the end of the innermost containing
+//    block.
+
+// The walk functions below, like ast.Inspect, recurse once per nested scope.
+// The depth is bounded by go/parser, which rejects files whose scopes nest
+// more than 1000 levels deep, so the recursion can't overflow the stack.
+
+func walkFile(file *ast.File) *Scope {
+	cur := newScope(file)
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch x := node.(type) {
+		case *ast.ValueSpec:
+			for _, name := range x.Names {
+				cur.addIdent(name)
+			}
+			return true // For instance, FuncLit can be inside
+		case *ast.TypeSpec:
+			cur.addIdent(x.Name)
+			// no more exploration to do since no scope can exist inside; TypeSpecs
+			// have FieldLists inside them, not BlockStmts
+			return false
+		case *ast.FuncDecl:
+			if x.Recv == nil {
+				// only if it isn't a method
+				cur.addIdent(x.Name)
+			}
+			inner := walkFuncDecl(x)
+			cur.inner = append(cur.inner, inner)
+			inner.outer = cur
+			return false // walkFuncDecl would have explored the inner scopes
+		case *ast.FuncLit:
+			// unlike a FuncDecl, a FuncLit has no name,
+			// so there's no ident to add to cur.
+			inner := walkFuncLit(x)
+			cur.inner = append(cur.inner, inner)
+			inner.outer = cur
+			return false // walkFuncLit would have explored the inner scopes
+		}
+		return true
+	})
+
+	cur.markDone()
+	return cur
+}
+
+func walkFuncDecl(x *ast.FuncDecl) *Scope {
+	cur := newScope(x)
+
+	// add receivers idents
+	if x.Recv != nil {
+		for _, field := range x.Recv.List {
+			for _, name := range field.Names {
+				cur.addIdent(name)
+			}
+		}
+	}
+	// add params idents
+	for _, field := range x.Type.Params.List {
+		for _, name := range field.Names {
+			cur.addIdent(name)
+		}
+	}
+	// add returns idents
+	if x.Type.Results != nil {
+		for _, field := range x.Type.Results.List {
+			for _, name := range field.Names {
+				cur.addIdent(name)
+			}
+		}
+	}
+	// walk the body
+	if x.Body != nil {
+		blockScope := walkBlockStmt(x.Body)
+		cur.inner = append(cur.inner, blockScope)
+		blockScope.outer = cur
+	}
+
+	cur.markDone()
+	return cur
+}
+
+// walkFuncLit is similar to walkFuncDecl expect that a FuncLit doesn't have
+// receivers.
+func walkFuncLit(x *ast.FuncLit) *Scope {
+	cur := newScope(x)
+
+	// add params idents
+	for _, field := range x.Type.Params.List {
+		for _, name := range field.Names {
+			cur.addIdent(name)
+		}
+	}
+	// add returns idents
+	if x.Type.Results != nil {
+		for _, field := range x.Type.Results.List {
+			for _, name := range field.Names {
+				cur.addIdent(name)
+			}
+		}
+	}
+	// walk the body
+	if x.Body != nil {
+		blockScope := walkBlockStmt(x.Body)
+		cur.inner = append(cur.inner, blockScope)
+		blockScope.outer = cur
+	}
+
+	cur.markDone()
+	return cur
+}
+
+func walkBlockStmt(x *ast.BlockStmt) *Scope {
+	cur := newScope(x)
+	cur.lbrace = x.Lbrace
+	cur.rbrace = x.Rbrace
+	walkStmts(cur, x)
+	cur.markDone()
+	return cur
+}
+
+// walkRangeStmt returns the scope for the body of a range loop. The iteration
+// variables declared by the range clause are declared in the body's scope, so
+// that the range expression doesn't see them.
+func walkRangeStmt(x *ast.RangeStmt) *Scope {
+	cur := newScope(x.Body)
+	cur.lbrace = x.Body.Lbrace
+	cur.rbrace = x.Body.Rbrace
+	if x.Tok == token.DEFINE {
+		for _, expr := range []ast.Expr{x.Key, x.Value} {
+			if ident, ok := expr.(*ast.Ident); ok {
+				cur.addIdent(ident)
+			}
+		}
+	}
+	walkStmts(cur, x.Body)
+	cur.markDone()
+	return cur
+}
+
+// walkStmtScope returns the scope of an "if", "for", "switch", or type switch
+// statement. Each such statement is an implicit block, in which the variables
+// declared by its init statement are declared, and which encloses the
+// statement's body and, for an "if" statement, its "else" branch.
+func walkStmtScope(x ast.Stmt) *Scope {
+	cur := newScope(x)
+
+	switch x := x.(type) {
+	case *ast.IfStmt, *ast.ForStmt:
+		walkStmts(cur, x)
+	case *ast.SwitchStmt:
+		if x.Init != nil {
+			walkStmts(cur, x.Init)
+		}
+		if x.Tag != nil {
+			walkStmts(cur, x.Tag)
+		}
+		walkCaseClauses(cur, x.Body, nil)
+	case *ast.TypeSwitchStmt:
+		if x.Init != nil {
+			walkStmts(cur, x.Init)
+		}
+		// In 'switch v := x.(type)', v is declared in each clause,
+		// so only the Rhs is walked here.
+		var guard *ast.Ident
+		switch a := x.Assign.(type) {
+		case *ast.AssignStmt:
+			if len(a.Lhs) == 1 {
+				guard, _ = a.Lhs[0].(*ast.Ident)
+			}
+			for _, expr := range a.Rhs {
+				walkStmts(cur, expr)
+			}
+		case *ast.ExprStmt:
+			walkStmts(cur, a)
+		}
+		walkCaseClauses(cur, x.Body, guard)
+	default:
+		panicf("[code bug] unexpected statement %T", x)
+	}
+
+	cur.markDone()
+	return cur
+}
+
+// walkCaseClauses adds the scopes of the clauses in the body of a switch
+// statement to cur's inner scopes. guard is the variable declared by a type
+// switch, or nil.
+func walkCaseClauses(cur *Scope, body *ast.BlockStmt, guard *ast.Ident) {
+	for _, stmt := range body.List {
+		clause, ok := stmt.(*ast.CaseClause)
+		if !ok {
+			continue
+		}
+		inner := walkCaseClause(clause, guard, cur)
+		cur.inner = append(cur.inner, inner)
+		inner.outer = cur
+	}
+}
+
+// walkCaseClause returns the scope for a clause of a switch statement. The
+// guard variable of a type switch, if any, is declared in each clause's scope
+// and not in the enclosing block. The expressions or types listed in the
+// clause are walked in outer.
+func walkCaseClause(x *ast.CaseClause, guard *ast.Ident, outer *Scope) *Scope {
+	cur := newScope(x)
+	if guard != nil {
+		// The spec declares the variable at the end of the TypeSwitchCase,
+		// so the types listed in the clause still see the outer names.
+		cur.addIdent(&ast.Ident{NamePos: x.Colon, Name: guard.Name})
+	}
+	for _, expr := range x.List {
+		walkStmts(outer, expr)
+	}
+	for _, stmt := range x.Body {
+		walkStmts(cur, stmt)
+	}
+	cur.markDone()
+	return cur
+}
+
+// walkCommClause returns the scope for a clause of a select statement, in
+// which the variables declared by a receive statement, as in
+// 'case v := <-ch', are declared.
+func walkCommClause(x *ast.CommClause) *Scope {
+	cur := newScope(x)
+	walkStmts(cur, x)
+	cur.markDone()
+	return cur
+}
+
+// walkStmts adds the identifiers declared in node to cur, and the scopes
+// nested in node to cur's inner scopes.
+func walkStmts(cur *Scope, node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		if node == cur.node {
+			// Skip the node that defines cur.
+			// It should have been handled by the caller.
+			return true
+		}
+		switch xx := node.(type) {
+		case *ast.ValueSpec:
+			for _, name := range xx.Names {
+				cur.addIdentFrom(name, xx.End())
+			}
+			return true
+		case *ast.FuncLit:
+			inner := walkFuncLit(xx)
+			cur.inner = append(cur.inner, inner)
+			inner.outer = cur
+			return false
+		case *ast.TypeSpec:
+			cur.addIdent(xx.Name)
+			return false
+		case *ast.AssignStmt:
+			// The Lhs contains the identifier.  We only care about short
+			// variable declarations, which use token.DEFINE.
+			if xx.Tok == token.DEFINE {
+				for _, expr := range xx.Lhs {
+					if ident, ok := expr.(*ast.Ident); ok {
+						cur.addIdentFrom(ident, xx.End())
+					}
+				}
+			}
+			return true // because the Rhs can be a FuncLit, for instance
+		case *ast.LabeledStmt:
+			cur.addIdent(xx.Label)
+			return true
+		case *ast.RangeStmt:
+			walkStmts(cur, xx.X)
+			inner := walkRangeStmt(xx)
+			cur.inner = append(cur.inner, inner)
+			inner.outer = cur
+			return false
+		case *ast.IfStmt, *ast.ForStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt:
+			inner := walkStmtScope(xx.(ast.Stmt))
+			cur.inner = append(cur.inner, inner)
+			inner.outer = cur
+			return false // walkStmtScope above would have explored the inner scopes
+		case *ast.SelectStmt:
+			for _, stmt := range xx.Body.List {
+				clause, ok := stmt.(*ast.CommClause)
+				if !ok {
+					continue
+				}
+				inner := walkCommClause(clause)
+				cur.inner = append(cur.inner, inner)
+				inner.outer = cur
+			}
+			return false
+		case *ast.BlockStmt:
+			inner := walkBlockStmt(xx)
+			cur.inner = append(cur.inner, inner)
+			inner.outer = cur
+			return false // walkBlockStmt above would have explored the inner scopes
+		}
+		return true
+	})
+}
@@ -0,0 +1,352 @@
+package dedup
+
+import (
+	"fmt"
+	"go/ast"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// KeepStrategy chooses which import to keep from a group of duplicate
+// imports.
+type KeepStrategy interface {
+	// Choose returns the index of the spec to keep. The group has at least
+	// two specs, all with the same import path, in source order.
+	Choose(group []*ast.ImportSpec) int
+}
+
+// StrictKeepStrategy is a KeepStrategy that can also report whether its
+// choice was unambiguous. It is used with Options.Strict;
+// strategies that don't implement it are assumed to always be unambiguous.
+type StrictKeepStrategy interface {
+	KeepStrategy
+	// ChooseStrict is like Choose, but ok is false if the strategy could not
+	// uniquely determine the spec to keep and fell back to a default.
+	ChooseStrict(group []*ast.ImportSpec) (idx int, ok bool)
+}
+
+// UsageKeepStrategy is a KeepStrategy that chooses based on how much each
+// import is used in the file. If the strategy used implements it,
+// ChooseByUsage is called instead of Choose.
+type UsageKeepStrategy interface {
+	KeepStrategy
+	// ChooseByUsage is like Choose, but is also given, for each spec, the
+	// number of selector expressions in the file that use the spec's
+	// package name, like "pkg.Foo".
+	ChooseByUsage(group []*ast.ImportSpec, uses []int) int
+}
+
+// StrictUsageKeepStrategy is a UsageKeepStrategy that can also report
+// whether its choice was unambiguous, like StrictKeepStrategy. It is used
+// with Options.Strict; usage strategies that don't implement it are assumed
+// to always be unambiguous.
+type StrictUsageKeepStrategy interface {
+	UsageKeepStrategy
+	// ChooseByUsageStrict is like ChooseByUsage, but ok is false if the
+	// strategy could not uniquely determine the spec to keep.
+	ChooseByUsageStrict(group []*ast.ImportSpec, uses []int) (idx int, ok bool)
+}
+
+// KeepStrategyFunc is an adapter to allow the use of ordinary functions as a
+// KeepStrategy.
+type KeepStrategyFunc func(group []*ast.ImportSpec) int
+
+func (f KeepStrategyFunc) Choose(group []*ast.ImportSpec) int { return f(group) }
+
+// strictFunc is the StrictKeepStrategy used by the built-in strategies.
+type strictFunc func(group []*ast.ImportSpec) (int, bool)
+
+func (f strictFunc) Choose(group []*ast.ImportSpec) int {
+	idx, _ := f(group)
+	return idx
+}
+
+func (f strictFunc) ChooseStrict(group []*ast.ImportSpec) (int, bool) { return f(group) }
+
+// strategies is the registry of keep strategies, keyed by the name used for
+// Options.Strategy.
+var strategies = map[string]KeepStrategy{
+	"unnamed": strictFunc(keepUnnamed),
+	"first":   strictFunc(keepFirst),
+	"last":    strictFunc(keepLast),
+	"comment": strictFunc(keepComment),
+	"named":   strictFunc(keepNamed),
+	"longest": strictFunc(keepLongest),
+
+	"shortest-path": strictFunc(keepShortestPath),
+	"least-churn":   leastChurn{},
+}
+
+// RegisterStrategy makes a keep strategy available by the provided name. If
+// RegisterStrategy is called twice with the same name, it panics.
+func RegisterStrategy(name string, s KeepStrategy) {
+	if _, dup := strategies[name]; dup {
+		panic(fmt.Sprintf("strategy %q already registered", name))
+	}
+	strategies[name] = s
+}
+
+// StrategyNames returns the names of the registered strategies, sorted.
+func StrategyNames() []string {
+	var names []string
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// keepUnnamed keeps the first unnamed import, or the first import if none
+// is unnamed. Multiple unnamed imports aren't ambiguous, since keeping any of
+// them results in the same package name.
+func keepUnnamed(group []*ast.ImportSpec) (int, bool) {
+	for i := range group {
+		if group[i].Name == nil {
+			return i, true
+		}
+	}
+	return 0, sameNames(group)
+}
+
+// sameNames reports whether the specs all have the same import name, in
+// which case the choice between them is never ambiguous: keeping any of them
+// results in the same file.
+func sameNames(group []*ast.ImportSpec) bool {
+	for i := 1; i < len(group); i++ {
+		if importName(group[i]) != importName(group[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+func keepFirst(group []*ast.ImportSpec) (int, bool) {
+	return 0, true
+}
+
+func keepLast(group []*ast.ImportSpec) (int, bool) {
+	return len(group) - 1, true
+}
+
+// keepComment keeps the first import with either a doc comment or a line
+// comment, or the first import if none has a comment. The choice is
+// ambiguous unless exactly one import has a comment, or the imports it
+// chooses from have the same name.
+func keepComment(group []*ast.ImportSpec) (int, bool) {
+	return keepCommented(group, false)
+}
+
+// keepCommentText is keepComment for Options.IgnoreDirectives. See
+// hasComment for what counts as a comment.
+func keepCommentText(group []*ast.ImportSpec) (int, bool) {
+	return keepCommented(group, true)
+}
+
+func keepCommented(group []*ast.ImportSpec, ignoreDirectives bool) (int, bool) {
+	var commented []*ast.ImportSpec
+	idx := -1
+	for i := range group {
+		if hasComment(group[i], ignoreDirectives) {
+			if idx == -1 {
+				idx = i
+			}
+			commented = append(commented, group[i])
+		}
+	}
+	if idx == -1 {
+		return 0, sameNames(group)
+	}
+	return idx, sameNames(commented)
+}
+
+// keepNamed keeps the shortest named import. If multiple exist with the same
+// shortest length, it keeps the first of those. If no import is named, it
+// keeps the first import. The choice is ambiguous unless there is a unique
+// shortest name, or no import is named.
+func keepNamed(group []*ast.ImportSpec) (int, bool) {
+	idx := -1
+	length := -1
+	tie := false
+	for i := range group {
+		if group[i].Name == nil {
+			continue
+		}
+		switch l := len(group[i].Name.Name); {
+		case l < length || length == -1:
+			idx = i
+			length = l
+			tie = false
+		case l == length && group[i].Name.Name != group[idx].Name.Name:
+			tie = true
+		}
+	}
+	if idx == -1 {
+		return 0, sameNames(group)
+	}
+	return idx, !tie
+}
+
+// keepLongest keeps the longest named import. If multiple exist with the
+// same longest length, it keeps the first of those. If no import is named, it
+// keeps the first import. The choice is ambiguous unless there is a unique
+// longest name, or no import is named.
+func keepLongest(group []*ast.ImportSpec) (int, bool) {
+	idx := -1
+	length := -1
+	tie := false
+	for i := range group {
+		if group[i].Name == nil {
+			continue
+		}
+		switch l := len(group[i].Name.Name); {
+		case l > length:
+			idx = i
+			length = l
+			tie = false
+		case l == length && group[i].Name.Name != group[idx].Name.Name:
+			tie = true
+		}
+	}
+	if idx == -1 {
+		return 0, sameNames(group)
+	}
+	return idx, !tie
+}
+
+// keepShortestPath keeps the import with the shortest normalized import
+// path, as written in the source, which is often the canonical,
+// non-versioned path. If multiple exist with the same shortest length, it
+// keeps the first of those. The choice is ambiguous if different paths tie.
+// The paths in a group differ only when Options.Canonicalize rewrote some of
+// them; otherwise it keeps the first import.
+func keepShortestPath(group []*ast.ImportSpec) (int, bool) {
+	return keepShortestWrittenPath(group, nil)
+}
+
+// keepShortestWrittenPath is keepShortestPath given the paths as written for
+// the specs whose paths were rewritten, as in deduper.writtenPaths.
+func keepShortestWrittenPath(group []*ast.ImportSpec, written map[*ast.ImportSpec]string) (int, bool) {
+	idx := 0
+	path := writtenPath(group[0], written)
+	tie := false
+	for i := 1; i < len(group); i++ {
+		p := writtenPath(group[i], written)
+		switch {
+		case len(p) < len(path):
+			idx = i
+			path = p
+			tie = false
+		case len(p) == len(path) && p != path:
+			tie = true
+		}
+	}
+	return idx, !tie
+}
+
+// leastChurn keeps the import whose package name is used the most in the
+// file, which minimizes the selector expressions to rewrite. If multiple are
+// used the most, it keeps the first of those. The choice is ambiguous if
+// imports with different names are used the most.
+type leastChurn struct{}
+
+func (leastChurn) Choose(group []*ast.ImportSpec) int { return 0 }
+
+func (l leastChurn) ChooseByUsage(group []*ast.ImportSpec, uses []int) int {
+	idx, _ := l.ChooseByUsageStrict(group, uses)
+	return idx
+}
+
+func (leastChurn) ChooseByUsageStrict(group []*ast.ImportSpec, uses []int) (int, bool) {
+	idx := 0
+	tie := false
+	for i := 1; i < len(group); i++ {
+		switch {
+		case uses[i] > uses[idx]:
+			idx = i
+			tie = false
+		case uses[i] == uses[idx] && importName(group[i]) != importName(group[idx]):
+			tie = true
+		}
+	}
+	return idx, !tie
+}
+
+// pinned returns the index of the spec in the group pinned with the marker,
+// and the number of pinned specs. No spec is pinned if marker is empty.
+func pinned(group []*ast.ImportSpec, marker string) (idx, count int) {
+	idx = -1
+	if marker == "" {
+		return idx, 0
+	}
+	for i := range group {
+		if hasMarker(group[i].Doc, marker) || hasMarker(group[i].Comment, marker) {
+			if idx == -1 {
+				idx = i
+			}
+			count++
+		}
+	}
+	return idx, count
+}
+
+// hasMarker reports whether a comment in the comment group begins with the
+// marker, ignoring the comment markers and leading space.
+func hasMarker(cg *ast.CommentGroup, marker string) bool {
+	if cg == nil {
+		return false
+	}
+	for _, c := range cg.List {
+		text := strings.TrimPrefix(c.Text, "//")
+		if strings.HasPrefix(c.Text, "/*") {
+			text = strings.TrimSuffix(strings.TrimPrefix(c.Text, "/*"), "*/")
+		}
+		if strings.HasPrefix(strings.TrimSpace(text), marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasComment reports whether the spec has a doc comment or a line comment.
+// If ignoreDirectives is set, comments made up of only directives, such as
+// "//nolint" or "//go:embed", and empty comments don't count.
+func hasComment(spec *ast.ImportSpec, ignoreDirectives bool) bool {
+	if !ignoreDirectives {
+		return spec.Doc != nil || spec.Comment != nil
+	}
+	return hasText(spec.Doc) || hasText(spec.Comment)
+}
+
+// hasText reports whether the comment group has a comment that is neither
+// empty nor a directive.
+func hasText(cg *ast.CommentGroup) bool {
+	if cg == nil {
+		return false
+	}
+	for _, c := range cg.List {
+		if isDirective(c.Text) {
+			continue
+		}
+		text := strings.TrimPrefix(c.Text, "//")
+		if strings.HasPrefix(c.Text, "/*") {
+			text = strings.TrimSuffix(strings.TrimPrefix(c.Text, "/*"), "*/")
+		}
+		if strings.TrimSpace(text) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isDirective reports whether the comment text is a directive. By
+// convention, directives are line comments without a space after the "//",
+// for example "//go:generate" or "//nolint".
+func isDirective(text string) bool {
+	if !strings.HasPrefix(text, "//") || len(text) == len("//") {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(text[len("//"):])
+	return !unicode.IsSpace(r)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitReporter writes the findings as a JUnit XML report for CI systems.
+// Each file is a test case: a file with duplicate imports is a failure, a
+// file that could not be processed is an error, and any other file passes.
+type junitReporter struct {
+	cases []junitTestCase
+}
+
+func (j *junitReporter) Record(w io.Writer, r fileReport) error {
+	c := junitTestCase{Name: r.Filename, ClassName: "dedupimport"}
+	switch {
+	case r.Errors != "":
+		c.Error = &junitMessage{
+			Message: "failed to process file",
+			Type:    "error",
+			Text:    r.Errors,
+		}
+	case len(r.Removed) != 0:
+		var buf bytes.Buffer
+		textReporter{}.Record(&buf, r)
+		c.Failure = &junitMessage{
+			Message: fmt.Sprintf("%d duplicate import(s)", len(r.Removed)),
+			Type:    "duplicate-import",
+			Text:    buf.String(),
+		}
+	}
+	j.cases = append(j.cases, c)
+	return nil
+}
+
+func (j *junitReporter) Flush(w io.Writer) error {
+	suite := junitTestSuite{Name: "dedupimport", Tests: len(j.cases), Cases: j.cases}
+	for _, c := range j.cases {
+		if c.Failure != nil {
+			suite.Failures++
+		}
+		if c.Error != nil {
+			suite.Errors++
+		}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeReportFile writes the rest of the report to the named file.
+func writeReportFile(filename string, r Reporter) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := r.Flush(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/nishanths/dedupimport/dedup"
+)
+
+// writeEdits writes the file's edits as a JSON object on a single line.
+func writeEdits(out io.Writer, filename string, result *dedup.Result) error {
+	edits := result.Edits
+	if edits == nil {
+		edits = []dedup.TextEdit{}
+	}
+	return json.NewEncoder(out).Encode(struct {
+		Filename string           `json:"filename"`
+		Edits    []dedup.TextEdit `json:"edits"`
+	}{filename, edits})
+}
@@ -9,12 +9,27 @@
 // identifier to use the new import identifier.
 //
 // As a special case, the tool never removes side-effect imports ("_") and
-// dot imports ("."); these imports are allowed to coexist with regular
-// imports, even if the import paths are duplicated.
+// dot imports (".") in favor of regular imports; these imports are allowed
+// to coexist with regular imports, even if the import paths are duplicated.
+// With the '-collapse-redundant-blank' flag, however, a side-effect import is
+// removed if a regular import of the same path exists, named or not, since
+// the regular import already runs the package's initialization. Dot imports
+// of the same path are duplicates of each other, though, and all but the
+// first are removed. So are side-effect imports of a path that isn't
+// otherwise imported. Imports of the cgo pseudo-package "C" are never
+// removed, since each can have its own preamble.
 //
 // The command exits with exit code 2 if the command was invoked incorrectly;
-// 1 if there was an error while opening, parsing, or rewriting files; and
-// 0 otherwise.
+// 1 if there was an error while opening, parsing, or rewriting files, or, with
+// '-check', if any file had duplicate imports; and 0 otherwise. With the
+// '-count-exit' flag, the command instead exits with 10 if any file had
+// duplicate imports, unless one of the previous non-zero exit codes applies,
+// which take precedence.
+//
+// The deduping is implemented by the package
+// github.com/nishanths/dedupimport/dedup, which can be used by editor plugins
+// and other tools that want to dedupe imports without running the command.
+// Its Options correspond to the command's flags.
 //
 // The typical usage is:
 //
@@ -22,6 +37,142 @@
 //   dedupimport -w file.go         # overwrite original source file
 //   dedupimport -d file.go         # display diff
 //   dedupimport -l file.go dir     # list the filenames that have duplicate imports
+//   dedupimport -w ./...           # overwrite the files in the current directory tree
+//
+// Like gofmt, without a flag such as -w, the command prints every file
+// handled to stdout, including files without duplicate imports, which are
+// printed unchanged. The '-quiet-unchanged' flag prints only the files that
+// changed.
+//
+// A path ending in "/...", such as "./...", is a pattern, as with the go
+// command: it handles the directory before the "..." and its subdirectories,
+// skipping testdata directories, directories beginning with "." or "_", and
+// vendor directories, which the '-vendor' flag includes. Other directory
+// paths handle every Go file in the directory tree.
+//
+// The files in a directory tree are processed concurrently, at most '-p' at a
+// time, which defaults to the number of CPUs. The output is in path order
+// regardless.
+//
+// Without paths, the command reads from stdin. A path of "-" also reads
+// stdin, so that stdin can be handled along with files. The
+// '-stdin-filename' flag names the file that the stdin content belongs to.
+// The name is used in output, and with -w, the result is written to that
+// file, which must exist and be writable:
+//
+//   dedupimport -w -stdin-filename file.go < buffer.go
+//
+// The '-filelist' flag also handles the .go files listed, one per line, in a
+// file, or in stdin for "-", which avoids limits on the length of the command
+// line and composes with version control tools. Other lines are ignored:
+//
+//   git diff --name-only main | dedupimport -w -filelist -
+//
+// The '-json' flag prints a JSON array with an entry for each file handled,
+// including stdin, describing the duplicate imports and any errors:
+//
+//   dedupimport -json -stdin-filename main.go - util.go < buffer.go
+//
+// Each removed import is described by its path, its name and position, the
+// name and position of the import kept instead, and the strategy that chose
+// the kept import: the '-keep' strategy, or "pin", "prefer-explicit", or
+// "collapse-blank" when '-pin-marker', '-prefer-explicit-on-conflict', or
+// '-collapse-redundant-blank' decided instead, or "dot" or "blank" for a
+// duplicate dot or side-effect import.
+//
+// The '-junit' flag writes a JUnit XML report for CI systems, in addition to
+// the usual output. Each file handled is a test case, which fails if the file
+// has duplicate imports, and is an error if the file could not be processed.
+//
+// The '-report-format' flag prints a report of the duplicate imports instead
+// of the results, in one of the formats: text, the default, with a
+// file:line:column diagnostic for each duplicate import, as printed by
+// '-diagnostics'; json, as printed by '-json'; junit; or sarif, a SARIF log
+// for code scanning tools. The text format is only printed with
+// '-diagnostics'. With -w, files are written in addition to printing the
+// report, except with '-diagnostics':
+//
+//   dedupimport -report-format sarif dir > dedupimport.sarif
+//
+// The '-region' flag, for editor integrations that operate on a selection,
+// limits the rewritten selectors to the byte offset range start:end of the
+// file. Duplicate imports are still removed, unless their package name is
+// also used outside the range, in which case they are kept:
+//
+//   dedupimport -region 120:480 file.go
+//
+// The '-imports-only-parse' flag parses only the package clause and the import
+// declarations, so that imports can be cleaned up in a file that has syntax
+// errors elsewhere, such as one being edited. Since the rest of the file isn't
+// parsed, references can't be rewritten: only duplicates with the same name as
+// the kept import are removed, and the rest of the file is left as is.
+//
+// The '-build-check' flag, with -w, runs 'go build' on the package in each
+// directory with modified files after processing, as a safety net against
+// rewrites that break the code. The files of a package that fails to build
+// are restored to their original content, and the failure is reported. With
+// '-print-changed' or '-l', the files are listed after the check, leaving out
+// the restored files. The packages must be buildable with the go command, for
+// instance by being in a module; the check is opt-in since building can be
+// slow:
+//
+//   dedupimport -w -build-check .
+//
+// The '-trim-trailing-comment' flag removes the line comments of the imports
+// kept in place of duplicate imports, so that the cleaned up imports have no
+// trailing comments. Unlike '-comments drop', doc comments are kept.
+//
+// Generated files, which have a comment of the form
+//
+//   // Code generated ... DO NOT EDIT.
+//
+// are skipped, since changes to them would be lost when they are
+// regenerated. With -l, the command prints a note for each file skipped. The
+// '-generated' flag handles them too.
+//
+// With -w, files that are symlinks are skipped with a warning, since writing
+// them would modify their targets, which may be outside the tree. Use
+// '-skip-symlinks=false' to write the targets.
+//
+// The '-out-dir' flag writes the result for each file with duplicate imports
+// under the given directory instead, at the file's path relative to the path
+// argument it was found in, leaving the originals as they are. This is useful
+// for producing a tree of proposed changes for review. With
+// '-out-dir-copy-unchanged', the other files are written too, so that the
+// directory holds a complete copy of the Go files:
+//
+//   dedupimport -out-dir proposed ./src
+//
+// At most one of -w, -d, -l, -check, -count, -out-dir, and -dry-run may be
+// used, except that, as with gofmt, -w may be used with -d to write files and
+// print the diff of the changes made, and with -l to list the files written.
+// Only -w, which overwrites the files, and -out-dir, which writes the results
+// elsewhere, write files.
+//
+// The '-dry-run' flag processes files, reporting errors and setting the exit
+// code, but neither prints nor writes results.
+//
+// The '-count' flag prints only the total number of duplicate imports that
+// would be removed from the files handled, without rewriting them. With
+// '-count-exit', the command exits with exit code 10 if the number isn't 0:
+//
+//   dedupimport -count -count-exit ./...
+//
+// The '-check' flag, for CI, only looks for duplicate imports, without
+// rewriting files or printing source. It prints a line for each file with
+// duplicate imports, with the position of the first duplicate and the paths
+// imported more than once, and exits with exit code 1 if there were any:
+//
+//   dedupimport -check dir
+//
+// Both report the same imports that '-w' would remove, with the same flags,
+// and report the same errors for files that can't be rewritten.
+//
+// The '-archive-in' flag processes the Go files in a zip or tar archive
+// instead, without extracting it. The command lists the entries with
+// duplicate imports, and, if '-archive' is given, writes the rewritten archive:
+//
+//   dedupimport -archive-in src.zip -archive out.zip
 //
 // Example
 //
@@ -51,15 +202,74 @@
 // Strategy to use when resolving duplicates
 //
 // The '-keep' flag allows you to choose which import to keep and which ones to
-// remove when resolving duplicates in a file, aka the strategy to use:
+// remove when resolving duplicates in a file, aka the strategy to use. The
+// built-in strategies are:
 //
 //   - the "unnamed" strategy keeps the unnamed import if one exists, or the
 //     first import otherwise;
 //   - the "named" strategy keeps the first-occurring shortest named import if
 //     one exists, or the first import otherwise;
+//   - the "longest" strategy keeps the first-occurring longest named import
+//     if one exists, or the first import otherwise, for code bases where the
+//     longer names are the descriptive ones;
 //   - the "comment" strategy keeps the first-occurring import with either a
-//     doc or a line comment if one exists, or the first import otherwise; and
-//   - the "first" strategy keeps the first import.
+//     doc or a line comment if one exists, or the first import otherwise
+//     (with '-comment-ignore-directives', comments that are only directives,
+//     such as "//nolint", or empty don't count);
+//   - the "least-churn" strategy keeps the first-occurring import whose
+//     package name is used the most in the file, to minimize the rewrites;
+//   - the "shortest-path" strategy keeps the first-occurring import with the
+//     shortest import path, which only differs from "first" for groups of
+//     different paths;
+//   - the "first" strategy keeps the first import; and
+//   - the "last" strategy keeps the last import, for files where the most
+//     recently added import is the canonical one.
+//
+// By default, when a strategy has no single import to choose (for instance,
+// the "comment" strategy for imports without comments, or the "least-churn"
+// strategy for imports with different names used equally often), it falls
+// back to keeping the first import. With the '-strict-strategy' flag, the
+// command instead reports an error for such duplicates and skips the file.
+//
+// With the '-treat-aliases-as-distinct' flag, imports of the same path with
+// different names, such as foo "x" and bar "x", are considered intentionally
+// distinct. Only exact duplicates, with the same name and path, are removed,
+// so no selector expressions need rewriting. The command prints a warning for
+// each import of a path kept with a different name.
+//
+// The '-pin-marker' flag pins the import to keep, regardless of the strategy:
+// of a group of duplicates, the import with a doc or line comment that begins
+// with the marker is kept. For example, with '-pin-marker keepme':
+//
+//   import (
+//       "net/url"
+//       u "net/url" // keepme
+//   )
+//
+// If more than one import in a group is pinned, the command reports an error
+// and skips the file.
+//
+// The '-keep-path-regexp' flag keeps the first import of a group whose path,
+// as written in the file, matches the regular expression, unless an import is
+// pinned. Paths only differ within a group with '-canonicalize', so this
+// chooses between the imports written with and without the major version
+// path:
+//
+//   dedupimport -canonicalize example.com/foo=v2 -keep-path-regexp /v2 file.go
+//
+// The '-name-filter' flag only removes the duplicate imports of packages
+// whose names match the regular expression, leaving other duplicates alone.
+// The name is the package's name, not the import names used, so that, for
+// example, '-name-filter pb$' cleans up the imports of protobuf packages
+// however they are named.
+//
+// Additional strategies implementing dedup.KeepStrategy can be made available
+// to the flag using dedup.RegisterStrategy.
+//
+// With the "unnamed" strategy, the '-prefer-explicit-on-conflict' flag keeps
+// the first named import instead of the unnamed import when the unnamed
+// import's package name can only be guessed (see "Package name guessing"
+// below). The explicit name is known to be correct; the guess may not be.
 //
 // Inability to rewrite
 //
@@ -81,6 +291,19 @@
 //      ...
 //   }
 //
+// With '-on-conflict partial', the command instead keeps the duplicate
+// imports whose references can't be rewritten, such as "u" above, and
+// removes the other duplicates in the file.
+//
+// Similarly, the command skips a file if, after removing duplicates, two
+// imports of different paths have the same package name, for instance two
+// unnamed imports of packages both named "client". The
+// '-fix-name-collisions' flag instead aliases the later import to an unused
+// name, such as "client2", if references to a removed duplicate of it are
+// rewritten, which then use the alias. Other references are not changed,
+// since it isn't known which package they refer to; without references to
+// rewrite, the alias would be unused, and the file is still skipped.
+//
 // Package name guessing
 //
 // For unnamed imports, the command has to guess the import's package name by
@@ -104,15 +327,47 @@
 //
 //   dedupimport -m github.com/proj/serverimpl=server \
 //     -m github.com/priarie/go-k8s-client=clientk8s
+//
+// Before guessing, the command looks up the package's source with go/build,
+// which finds packages in GOPATH and the standard library. The '-resolve' flag
+// first asks 'go list', run in the file's directory, for the package's name,
+// which finds packages in the file's module, including those only in the
+// module cache. Each package is listed once per directory. If the package
+// can't be listed, such as for a standalone file outside any module and
+// GOPATH, the command falls back to the lookup and the guess, without
+// reporting an error.
+//
+// The '-canonicalize' flag rewrites the imports of a module, given by its
+// base path, to the path of a major version, before removing duplicates. For
+// instance, when migrating to v2 of a module, this rewrites imports of
+// example.com/foo and example.com/foo/bar to example.com/foo/v2 and
+// example.com/foo/v2/bar, and the rewritten imports are then deduplicated
+// with existing imports of the v2 paths:
+//
+//   dedupimport -canonicalize example.com/foo=v2 -w .
+//
+// Imports of other major versions, such as example.com/foo/v3, are left
+// alone. If the base paths of several mappings match an import, the longest
+// is used.
+//
+// The '-verify-mappings' flag warns about mappings whose package name looks
+// unlike the name guessed from the import path, which may be typos, such as
+// a mapping of github.com/sirupsen/logrus to yaml.
+//
+// Import ordering
+//
+// Like gofmt, the command sorts the imports in a file after removing
+// duplicates. If another tool is responsible for the ordering of imports, use
+// the '-order-sentinel' flag to specify a comment prefix, such as
+// "//goimports:". Imports in files containing a comment with the prefix are
+// left in their existing order.
 package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"go/ast"
-	"go/build"
-	"go/format"
 	"go/parser"
 	"go/scanner"
 	"go/token"
@@ -123,9 +378,12 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
-	"unicode"
+	"time"
+
+	"github.com/nishanths/dedupimport/dedup"
 )
 
 const help = `usage: dedupimport [flags] [path ...]
@@ -149,7 +407,7 @@ func (m MultiFlag) String() string {
 	return fmt.Sprint(m.m)
 }
 
-func (m MultiFlag) Set(val string) error {
+func (m *MultiFlag) Set(val string) error {
 	c := strings.Split(val, "=")
 	if len(c) != 2 {
 		return fmt.Errorf("wrong format for -%s: %s", m.name, val)
@@ -162,18 +420,138 @@ func (m MultiFlag) Set(val string) error {
 }
 
 var (
-	flagSet    = flag.NewFlagSet("dedupimport", flag.ExitOnError)
-	diff       = flagSet.Bool("d", false, "display diff instead of rewriting files")
-	allErrors  = flagSet.Bool("e", false, "report all parse errors, not just the first 10 on different lines")
-	list       = flagSet.Bool("l", false, "list files with duplicate imports")
-	overwrite  = flagSet.Bool("w", false, "write result to source file instead of stdout")
-	importOnly = flagSet.Bool("i", false, "only modify imports; don't adjust rest of the file")
-	strategy   = flagSet.String("keep", "unnamed", "which import to keep: first, comment, named, or unnamed")
-	pkgNames   = MultiFlag{name: "m"}
+	flagSet          = flag.NewFlagSet("dedupimport", flag.ExitOnError)
+	diff             = flagSet.Bool("d", false, "display diff instead of rewriting files")
+	allErrors        = flagSet.Bool("e", false, "report all parse errors, not just the first 10 on different lines")
+	list             = flagSet.Bool("l", false, "list files with duplicate imports")
+	count            = flagSet.Bool("count", false, "print the total number of duplicate imports in the files handled, without rewriting files")
+	check            = flagSet.Bool("check", false, "print a file:line line for each file with duplicate imports, without rewriting files, and exit with status 1 if there were any")
+	diagnose         = flagSet.Bool("diagnostics", false, "print a file:line:column diagnostic for each duplicate import instead of rewriting files")
+	dryRun           = flagSet.Bool("dry-run", false, "process files, but don't print or write results")
+	outDir           = flagSet.String("out-dir", "", "write results to the same relative paths under `dir` instead of rewriting files")
+	copyUnchanged    = flagSet.Bool("out-dir-copy-unchanged", false, "with -out-dir, also write files without duplicate imports")
+	quietUnchanged   = flagSet.Bool("quiet-unchanged", false, "don't print files without duplicate imports to stdout")
+	overwrite        = flagSet.Bool("w", false, "write result to source file instead of stdout")
+	countExit        = flagSet.Bool("count-exit", false, "exit with status 10 if any file had duplicate imports and there were no errors")
+	lspEdits         = flagSet.Bool("lsp-edits", false, "print the changes for each file as Language Server Protocol text edits in JSON, instead of rewriting files")
+	diffStrategy     = flagSet.Bool("diff-strategy", false, "print the duplicate imports for which the -keep strategy keeps a different import than the default strategy, instead of deduping")
+	showGuesses      = flagSet.Bool("show-guesses", false, "print the package name used for each import and where it came from, instead of deduping")
+	scopesJSON       = flagSet.Bool("scopes-json", false, "print the scopes and declared identifiers in each file as JSON, instead of deduping")
+	since            = flagSet.String("since", "", "only handle files modified after this RFC 3339 `time`, or changed since this git revision, including untracked files")
+	errorsFile       = flagSet.String("errors-file", "", "write parse and rewrite errors to this `file` instead of stderr")
+	reportFmt        = flagSet.String("report-format", "text", "print a report of the duplicate imports instead of the results in this `format`: text (with -diagnostics), json, junit, or sarif; with -w, in addition to writing files")
+	jsonReport       = flagSet.Bool("json", false, "print a JSON report of the duplicate imports in the files handled, instead of the results; with -w, in addition to writing files")
+	junitFile        = flagSet.String("junit", "", "write a JUnit XML report of the files handled to `file`")
+	affected         = flagSet.Bool("affected-packages", false, "with -w, print the directories containing modified files after processing")
+	printChg         = flagSet.Bool("print-changed", false, "with -w, print the names of files that were modified")
+	buildCheck       = flagSet.Bool("build-check", false, "with -w, run 'go build' on each package with modified files after processing, and restore the files of packages that fail to build")
+	importOnly       = flagSet.Bool("i", false, "only modify imports; don't adjust rest of the file")
+	importsOnlyParse = flagSet.Bool("imports-only-parse", false, "parse only the package clause and imports, for files with syntax errors elsewhere; only removes duplicates that don't need references rewritten")
+	strategy         = flagSet.String("keep", "unnamed", "which import to keep: "+strings.Join(dedup.StrategyNames(), ", "))
+	ignoreDirectives = flagSet.Bool("comment-ignore-directives", false, "with -keep comment, don't count directive-only comments such as //nolint")
+	keepSlot         = flagSet.String("keep-slot", "kept", "where to keep a group of duplicate imports: kept (the slot of the import chosen by -keep), first, or last")
+	keepCommentFrom  = flagSet.String("keep-comment-from", "slot", "whose comments a group of duplicate imports keeps: slot (those of the import at the kept slot), first, or last")
+	trimComment      = flagSet.Bool("trim-trailing-comment", false, "remove the line comments of the imports kept in place of duplicate imports, leaving doc comments")
+	comments         = flagSet.String("comments", "keep", "what to do with the comments of duplicate imports: keep (those of the kept import), merge (into the kept import), or drop (all)")
+	onConflict       = flagSet.String("on-conflict", "skip-file", "what to do with a file whose references can't be rewritten: skip-file, or partial (remove only the duplicates that can be)")
+	pinMarker        = flagSet.String("pin-marker", "", "keep the duplicate import with a comment beginning with `marker`, such as \"keepme\", regardless of the strategy")
+	resolveNames     = flagSet.Bool("resolve", false, "resolve package names with 'go list' before looking them up or guessing them")
+	nameFilter       = flagSet.String("name-filter", "", "only remove duplicate imports of packages whose names match this `regexp`, such as pb$")
+	keepPath         = flagSet.String("keep-path-regexp", "", "keep the first duplicate import whose path, as written, matches this `regexp`, such as to prefer imports written with the /v2 path with -canonicalize")
+	strict           = flagSet.Bool("strict-strategy", false, "fail instead of falling back when the -keep strategy can't uniquely choose an import")
+	collapse         = flagSet.Bool("collapse-redundant-blank", false, "remove side-effect imports when a regular import of the same path exists")
+	fixCollisions    = flagSet.Bool("fix-name-collisions", false, "alias imports whose package names collide with other imports, instead of reporting an error")
+	distinctAliases  = flagSet.Bool("treat-aliases-as-distinct", false, "only remove imports with the same name and path, and report imports of the same path with different names")
+	verifyMappings   = flagSet.Bool("verify-mappings", false, "warn about -m mappings whose package name looks unlike the import path")
+	explicit         = flagSet.Bool("prefer-explicit-on-conflict", false, "with -keep unnamed, keep a named import instead if the unnamed import's package name would be guessed")
+	sentinel         = flagSet.String("order-sentinel", "", "don't sort imports in files containing a comment with this `prefix`")
+	dumpAST          = flagSet.Bool("ast", false, "print the AST of each rewritten file, before formatting, to stderr, for debugging")
+	simplifyAST      = flagSet.Bool("simplify", false, "also simplify code, like gofmt -s, in files with duplicate imports")
+	tabWidth         = flagSet.Int("tabwidth", 8, "tab width used when formatting output")
+	useSpaces        = flagSet.Bool("use-spaces", false, "indent output with spaces instead of tabs")
+	keepDocRef       = flagSet.Bool("keep-doc-referenced", false, "keep duplicate imports whose package name is used, as in pkg.Name, in a comment")
+	rewriteGen       = flagSet.Bool("rewrite-generate", false, "also rewrite package names used in //go:generate directives")
+	archiveIn        = flagSet.String("archive-in", "", "process the Go files in this zip or tar `archive` instead of paths")
+	archiveOut       = flagSet.String("archive", "", "with -archive-in, write the rewritten archive to this `file`")
+	fileList         = flagSet.String("filelist", "", "also handle the .go files listed, one per line, in this `file`, or in stdin for \"-\"")
+	stdinName        = flagSet.String("stdin-filename", "", "`filename` of the stdin content, used in output and as the file to write with -w")
+	maxErrors        = flagSet.Int("max-errors", 0, "report at most `n` rewrite errors per file; 0 means no limit")
+	skipSymlinks     = flagSet.Bool("skip-symlinks", true, "with -w, skip files that are symlinks instead of writing their targets")
+	generated        = flagSet.Bool("generated", false, "also handle generated files, which have a \"// Code generated ... DO NOT EDIT.\" comment")
+	parallel         = flagSet.Int("p", runtime.NumCPU(), "process at most `n` files in directories concurrently; output is in the same order regardless")
+	vendor           = flagSet.Bool("vendor", false, "also handle vendor directories matched by ./... patterns")
+	maxDepth         = flagSet.Int("max-depth", -1, "descend at most `n` levels of subdirectories in directories; 0 handles only their files, and -1 means no limit")
+	maxSize          = flagSet.Int64("max-file-size", 0, "skip files larger than this many `bytes`; 0 means no limit")
+	pkgNames         = MultiFlag{name: "m"}
+	canonical        = MultiFlag{name: "canonicalize"}
+	region           dedup.Region
 )
 
 var exitCode = 0
 
+// The compiled '-keep-path-regexp' and '-name-filter' patterns; nil if the
+// flags aren't set.
+var (
+	keepPathRegexp   *regexp.Regexp
+	nameFilterRegexp *regexp.Regexp
+)
+
+// resolver resolves package names for '-resolve'.
+var resolver goListResolver
+
+// generatedRx matches the comment that marks a generated Go file.
+// See https://golang.org/s/generatedcode.
+var generatedRx = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated reports whether the Go source src is a generated file.
+func isGenerated(src []byte) bool {
+	return generatedRx.Match(src)
+}
+
+// modulevn matches a module major version, such as "v2".
+var modulevn = regexp.MustCompile(`^v\d+$`)
+
+// modifiedDirs is the set of directories containing files modified by '-w'.
+var modifiedDirs = make(map[string]bool)
+
+// writeAffectedPackages writes the directories in modifiedDirs, sorted, one
+// per line.
+func writeAffectedPackages(out io.Writer) {
+	var dirs []string
+	for d := range modifiedDirs {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+	for _, d := range dirs {
+		fmt.Fprintln(out, d)
+	}
+}
+
+// errOut is where errors from parsing and rewriting files are written.
+var errOut io.Writer = os.Stderr
+
+// changedExitCode is the exit code used with '-count-exit' when files had
+// duplicate imports.
+const changedExitCode = 10
+
+// duplicateCount is the number of duplicate imports found with '-count'.
+var duplicateCount = 0
+
+// anyChanged is whether any file handled had duplicate imports removed.
+var anyChanged = false
+
+// exitStatus returns the status the command should exit with. Errors take
+// precedence over '-count-exit'.
+func exitStatus() int {
+	if exitCode != 0 {
+		return exitCode
+	}
+	if *countExit && anyChanged {
+		return changedExitCode
+	}
+	return 0
+}
+
 func setExitCode(c int) {
 	if c > exitCode {
 		exitCode = c
@@ -182,665 +560,993 @@ func setExitCode(c int) {
 
 func main() {
 	flagSet.Var(&pkgNames, "m", "`mapping` from import path to package name; can be repeated")
+	flagSet.Var(&canonical, "canonicalize", "rewrite imports of the module with base path `base=vN` to its major version N path before deduping; can be repeated")
+	flagSet.Var(&region, "region", "only rewrite selectors within the byte offset range `start:end`")
 	flagSet.Usage = usage
 	flagSet.Parse(os.Args[1:])
 
-	switch *strategy {
-	case "first", "comment", "named", "unnamed":
+	if !validStrategy(*strategy) {
+		fmt.Fprintf(os.Stderr, "unknown value for -keep: %s (must be one of: %s)\n",
+			*strategy, strings.Join(dedup.StrategyNames(), ", "))
+		os.Exit(2)
+	}
+
+	switch *comments {
+	case "keep", "merge", "drop":
 	default:
-		fmt.Fprintf(os.Stderr, "unknown value for -keep: %s\n", *strategy)
+		fmt.Fprintf(os.Stderr, "unknown value for -comments: %s\n", *comments)
+		os.Exit(2)
+	}
+	switch *onConflict {
+	case "skip-file", "partial":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown value for -on-conflict: %s\n", *onConflict)
+		os.Exit(2)
+	}
+	switch *keepSlot {
+	case "kept", "first", "last":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown value for -keep-slot: %s\n", *keepSlot)
+		os.Exit(2)
+	}
+	switch *keepCommentFrom {
+	case "slot", "first", "last":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown value for -keep-comment-from: %s\n", *keepCommentFrom)
+		os.Exit(2)
+	}
+	if *trimComment && *comments == "merge" {
+		fmt.Fprint(os.Stderr, "cannot use -trim-trailing-comment with -comments merge\n")
+		os.Exit(2)
+	}
+	if *keepCommentFrom != "slot" && *comments != "keep" {
+		fmt.Fprint(os.Stderr, "cannot use -keep-comment-from with -comments merge or drop\n")
 		os.Exit(2)
 	}
 
-	// fset is the FileSet for the entire command invocation.
-	var fset = token.NewFileSet()
+	if *tabWidth < 0 {
+		fmt.Fprintf(os.Stderr, "invalid value for -tabwidth: %d\n", *tabWidth)
+		os.Exit(2)
+	}
+	if *maxDepth < -1 {
+		fmt.Fprintf(os.Stderr, "invalid value for -max-depth: %d\n", *maxDepth)
+		os.Exit(2)
+	}
+	if *parallel < 1 {
+		fmt.Fprintf(os.Stderr, "invalid value for -p: %d\n", *parallel)
+		os.Exit(2)
+	}
+	if *maxErrors < 0 {
+		fmt.Fprintf(os.Stderr, "invalid value for -max-errors: %d\n", *maxErrors)
+		os.Exit(2)
+	}
 
-	if flagSet.NArg() == 0 {
-		if *overwrite {
-			fmt.Fprint(os.Stderr, "cannot use -w with stdin\n")
+	for base, v := range canonical.m {
+		if !modulevn.MatchString(v) || v == "v0" || v == "v1" {
+			fmt.Fprintf(os.Stderr, "invalid -canonicalize %s=%s: version must be v2 or higher\n", base, v)
 			os.Exit(2)
-		} else {
-			handleFile(fset, true, "<standard input>", os.Stdout) // use the same filename that gofmt uses
 		}
-	} else {
-		for i := 0; i < flagSet.NArg(); i++ {
-			path := flagSet.Arg(i)
-			info, err := os.Stat(path)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				setExitCode(1)
-			} else if info.IsDir() {
-				handleDir(fset, path)
-			} else {
-				handleFile(fset, false, path, os.Stdout)
-			}
+	}
+
+	if *keepPath != "" {
+		re, err := regexp.Compile(*keepPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -keep-path-regexp: %s\n", err)
+			os.Exit(2)
 		}
+		keepPathRegexp = re
+	}
+	if *nameFilter != "" {
+		re, err := regexp.Compile(*nameFilter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -name-filter: %s\n", err)
+			os.Exit(2)
+		}
+		nameFilterRegexp = re
 	}
 
-	if exitCode != 0 {
-		os.Exit(exitCode)
+	if *verifyMappings {
+		for _, w := range mappingWarnings() {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+		}
 	}
-}
 
-func parserMode() parser.Mode {
-	if *allErrors {
-		return parser.ParseComments | parser.AllErrors
+	if *since != "" {
+		if err := setSince(*since); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
 	}
-	return parser.ParseComments
-}
 
-type posSpan struct {
-	Start token.Pos
-	End   token.Pos
-}
+	if *errorsFile != "" {
+		f, err := os.Create(*errorsFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		errOut = f
+		defer f.Close() // runs if exiting normally
+	}
 
-func processFile(fset *token.FileSet, src []byte, filename string) (*ast.File, error) {
-	file, err := parser.ParseFile(fset, filename, src, parserMode())
+	m, err := resolveMode()
 	if err != nil {
-		return nil, err
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
+	mode = m
 
-	// Record positions for specs.
-	// Need to do this before updating file.Imports.
-	pos := make([]posSpan, len(file.Imports))
-	for i, s := range file.Imports {
-		pos[i] = posSpan{s.Pos(), s.End()}
+	if *printChg && !mode.writes() {
+		fmt.Fprint(os.Stderr, "cannot use -print-changed without -w\n")
+		os.Exit(2)
+	}
+	if *affected && !mode.writes() {
+		fmt.Fprint(os.Stderr, "cannot use -affected-packages without -w\n")
+		os.Exit(2)
+	}
+	if *buildCheck && !mode.writes() {
+		fmt.Fprint(os.Stderr, "cannot use -build-check without -w\n")
+		os.Exit(2)
 	}
 
-	// Find duplicate imports.
-	imports := markDuplicates(file.Imports)
+	if *archiveOut != "" && *archiveIn == "" {
+		fmt.Fprint(os.Stderr, "cannot use -archive without -archive-in\n")
+		os.Exit(2)
+	}
+	if _, ok := reportFormats[*reportFmt]; !ok {
+		fmt.Fprintf(os.Stderr, "unknown value for -report-format: %s\n", *reportFmt)
+		os.Exit(2)
+	}
+	if *jsonReport && *reportFmt != "text" && *reportFmt != "json" {
+		fmt.Fprintf(os.Stderr, "cannot use -json with -report-format %s\n", *reportFmt)
+		os.Exit(2)
+	}
+	if *jsonReport && mode != modeStdout && !mode.writes() {
+		fmt.Fprint(os.Stderr, "cannot use -json with -l, -d, -check, -count, -out-dir, or -dry-run\n")
+		os.Exit(2)
+	}
+	if *reportFmt != "text" && mode != modeStdout && !mode.writes() {
+		fmt.Fprint(os.Stderr, "cannot use -report-format with -l, -d, -check, -count, -out-dir, or -dry-run\n")
+		os.Exit(2)
+	}
+	setupReporters()
 
-	var keep, remove []*ast.ImportSpec
-	for _, im := range imports {
-		if im.remove {
-			remove = append(remove, im.spec)
-		} else {
-			keep = append(keep, im.spec)
+	stdinArgs := 0
+	for _, arg := range flagSet.Args() {
+		if arg == "-" {
+			stdinArgs++
 		}
 	}
-	if len(remove) == 0 {
-		// nothing to do
-		return nil, nil
+	if stdinArgs > 1 {
+		fmt.Fprint(os.Stderr, "cannot use - more than once\n")
+		os.Exit(2)
+	}
+	if *fileList == "-" && stdinArgs != 0 {
+		fmt.Fprint(os.Stderr, "cannot use - with -filelist -\n")
+		os.Exit(2)
+	}
+	// useStdin is whether the content of stdin is handled as a file.
+	useStdin := flagSet.NArg() == 0 && *fileList == "" || stdinArgs != 0
+	if *stdinName != "" && (!useStdin || *archiveIn != "") {
+		fmt.Fprint(os.Stderr, "cannot use -stdin-filename with paths other than -\n")
+		os.Exit(2)
+	}
+	if mode == modeOutDir && (flagSet.NArg() == 0 && *fileList == "" || *archiveIn != "") {
+		fmt.Fprint(os.Stderr, "cannot use -out-dir without paths\n")
+		os.Exit(2)
+	}
+	if *archiveIn != "" && (flagSet.NArg() != 0 || *fileList != "") {
+		fmt.Fprint(os.Stderr, "cannot use -archive-in with paths or -filelist\n")
+		os.Exit(2)
 	}
 
-	// Record comments.
-	cmap := ast.NewCommentMap(fset, file, file.Comments)
-
-	file.Imports = keep   // update the file's imports.
-	trimImportDecls(file) // update the file's AST.
-
-	// Get rid of comments that no longer belong.
-	file.Comments = cmap.Filter(file).Comments()
+	paths := flagSet.Args()
+	if *fileList != "" {
+		listed, err := readFileList(*fileList)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		paths = append(paths, listed...)
+	}
 
-	if !*importOnly {
-		srcDir := filepath.Dir(filename)
+	filename := "<standard input>" // use the same filename that gofmt uses
+	if *stdinName != "" {
+		filename = *stdinName
+	}
+	if *archiveIn == "" && useStdin && mode.writes() {
+		if *stdinName == "" {
+			fmt.Fprint(os.Stderr, "cannot use -w with stdin without -stdin-filename\n")
+			os.Exit(2)
+		}
+		if err := checkWritable(*stdinName); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -stdin-filename: %s\n", err)
+			os.Exit(2)
+		}
+	}
 
-		// Get the identifiers in scopes.
-		// We need it to check if rewriting selector exprs is safe.
-		scope := walkFile(file)
+	// fset is the FileSet for the entire command invocation. It is passed
+	// to the functions that need it rather than being a global, and is
+	// safe for use by the '-p' goroutines.
+	fset := token.NewFileSet()
 
-		// Build up the selector expr rewrite rules.
-		rules := make(map[string]string)
-		for _, im := range imports {
-			if !im.remove {
+	if *archiveIn != "" {
+		handleArchive(fset, *archiveIn, *archiveOut, os.Stdout)
+	} else if len(paths) == 0 && useStdin {
+		handleFile(fset, true, filename, os.Stdout)
+	} else {
+		for _, path := range paths {
+			if path == "-" {
+				handleFile(fset, true, filename, os.Stdout)
 				continue
 			}
-			from := packageNameForImport(im.spec, srcDir)
-			to := packageNameForImport(im.subsumedBy, srcDir)
-			rules[from] = to
-		}
-
-		// Rewrite.
-		err := rewriteSelectorExprs(fset, rules, scope, file.Name.Name)
-		if err != nil {
-			return nil, err
+			if isPattern(path) {
+				handlePattern(fset, path, os.Stdout)
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				setExitCode(1)
+			} else if info.IsDir() {
+				handleDir(fset, path, os.Stdout)
+			} else {
+				outRoot = filepath.Dir(path)
+				handleFile(fset, false, path, os.Stdout)
+			}
 		}
 	}
 
-	// If an import is removed, merge the next line into it.
-	for _, im := range imports {
-		if im.remove {
-			pos := im.spec.Pos()
-			line := fset.Position(pos).Line
-			fp := fset.File(pos)
-			if line >= fp.LineCount() {
-				// don't do merging at end of file
-				continue
-			}
-			fp.MergeLine(line)
+	if *buildCheck {
+		checkBuilds(os.Stdout, os.Stderr)
+	}
+	if mode == modeCount {
+		fmt.Println(duplicateCount)
+	}
+	if *affected {
+		writeAffectedPackages(os.Stdout)
+	}
+	if reporter != nil {
+		if err := reporter.Flush(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			setExitCode(1)
 		}
 	}
-	// Update the positions we recorded earlier.
-	// Don't have to worry about fixing up comments here
-	// because comments for removed imports would have already been removed
-	// by the commentMap work earlier.
-	for i, im := range imports {
-		s := im.spec
-		if s.Name != nil {
-			s.Name.NamePos = pos[i].Start
+	if junitFileReporter != nil {
+		if err := writeReportFile(*junitFile, junitFileReporter); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			setExitCode(1)
 		}
-		s.Path.ValuePos = pos[i].Start
-		s.EndPos = pos[i].End
 	}
 
-	return file, nil
+	if c := exitStatus(); c != 0 {
+		if f, ok := errOut.(*os.File); ok && f != os.Stderr {
+			f.Close()
+		}
+		os.Exit(c)
+	}
 }
 
-type scopeStack struct {
-	list []*Scope
+func handleFile(fset *token.FileSet, stdin bool, filename string, out io.Writer) {
+	if !stdin && checkSkip(filename).report() {
+		return
+	}
+	handleCheckedFile(fset, stdin, filename, out)
 }
 
-func (s *scopeStack) push(sc *Scope) {
-	s.list = append(s.list, sc)
+// skipCheck is the result of checkSkip.
+type skipCheck struct {
+	skip    bool
+	warning string // written to stderr by report, if set
+	err     error  // written to stderr by report, setting the exit code, if set
 }
 
-func (s *scopeStack) pop() *Scope {
-	if len(s.list) == 0 {
-		panic("pop of zero-length stack")
+// report writes the warning or error, if any, and reports whether the file is
+// skipped.
+func (c skipCheck) report() bool {
+	if c.err != nil {
+		fmt.Fprintln(os.Stderr, c.err)
+		setExitCode(1)
+	} else if c.warning != "" {
+		fmt.Fprintln(os.Stderr, c.warning)
 	}
-	res := s.list[len(s.list)-1]
-	s.list = s.list[:len(s.list)-1]
-	return res
+	return c.skip
 }
 
-// latest returns the latest non-nil entry in the stack
-// or nil if there is no such entry.
-func (s *scopeStack) latest() *Scope {
-	for i := len(s.list) - 1; i >= 0; i-- {
-		if s.list[i] != nil {
-			return s.list[i]
+// checkSkip checks whether the file is skipped, without reading it, because
+// of '-skip-symlinks', '-max-file-size', or '-since', or because it was
+// already visited. It records the file as visited, so it must
+// be called at most once per file.
+func checkSkip(filename string) skipCheck {
+	if *skipSymlinks && mode.writes() {
+		info, err := os.Lstat(filename)
+		if err != nil {
+			return skipCheck{skip: true, err: err}
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return skipCheck{skip: true, warning: fmt.Sprintf("warning: skipping %s: symlink; writing would modify the target", filename)}
 		}
 	}
-	return nil
+	if *maxSize > 0 || !sinceTime.IsZero() {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return skipCheck{skip: true, err: err}
+		}
+		if *maxSize > 0 && info.Size() > *maxSize {
+			return skipCheck{skip: true, warning: fmt.Sprintf("skipping %s: size %d bytes exceeds -max-file-size", filename, info.Size())}
+		}
+		if !sinceTime.IsZero() && !info.ModTime().After(sinceTime) {
+			return skipCheck{skip: true}
+		}
+	}
+	if sinceFiles != nil && !sinceFiles[absPath(filename)] {
+		return skipCheck{skip: true}
+	}
+	if !firstVisit(filename) {
+		return skipCheck{skip: true}
+	}
+	return skipCheck{}
 }
 
-// rewriteSelectorExprs rewrites selector exprs in the supplied scope based
-// on the rewrite rules. If a rewrite could not be performed, it will be
-// described in the returned error. The returned error will be of type
-// MultiError (even if there was only a single error).
-func rewriteSelectorExprs(fset *token.FileSet, rules map[string]string, root *Scope, pkgName string) error {
-	// first, map nodes to their scopes.
-	scopeByNode := make(map[ast.Node]*Scope)
-	root.each(func(s *Scope) bool {
-		scopeByNode[s.node] = s
-		return true
-	})
-
-	var errs MultiError
-	addError := func(e error) {
-		errs = append(errs, e)
-	}
-
-	// NOTE: this doesn't protect against package scope variables fully.
-	// For instance, 'var fe int' could be in a different file and visible
-	// across the package, but we would not warn about a "frontend" -> "fe"
-	// selector rewrite. This is okay for the most part, because
-	// the code would have had a compile error before anyway.
-	var stack scopeStack
-	ast.Inspect(root.node, func(node ast.Node) bool {
-		sc := scopeByNode[node]
-		if node != nil {
-			// enter a deeper level.  sc may be nil (because the node
-			// wasn't a scope creating node).
-			// the latest non-nil sc is the scope we want to track,
-			// and this is the scope that is returned by calling `latest`.
-			stack.push(sc)
-		}
-
-		switch x := node.(type) {
-		case *ast.SelectorExpr:
-			// we only care about package selector exprs,
-			// which should always have X be of type *ast.Ident.
-			ident, ok := x.X.(*ast.Ident)
-			if !ok {
-				// don't care
-				break
-			}
-			from := ident.Name
-			to, ok := rules[from]
-			if !ok {
-				// this selector expr is not one we want to rewrite
-				break
-			}
-			latest := stack.latest()
-			if latest == nil {
-				panicf("[code bug] selector expr should be in a scope, but unaware of any such scope")
-			}
-			if isGoKeyword(to) {
-				// source code must already have a parse or build error.
-				addError(&GoKeywordError{fset.Position(x.X.Pos()), from, to})
-				break
-			}
-			if !isValidIdent(to) {
-				// source code must already have a parse/build error.
-				addError(&InvalidIdentError{fset.Position(x.X.Pos()), from, to})
-				break
-			}
-			if id, ok := latest.available(to); ok && id.NamePos <= ident.NamePos { // exists && declared before
-				addError(&ScopeError{fset.Position(x.X.Pos()), from, to})
-				break
-			}
-			ident.Name = to // rewrite
+// handleCheckedFile is handleFile for a file that checkSkip has already
+// checked.
+func handleCheckedFile(fset *token.FileSet, stdin bool, filename string, out io.Writer) {
+	var src []byte
+	var err error
+	if stdin {
+		src, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		src, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		setExitCode(1)
+		return
+	}
+
+	if !*generated && isGenerated(src) {
+		if mode == modeList {
+			fmt.Fprintf(os.Stderr, "skipping %s: generated file\n", filename)
 		}
+		return
+	}
 
-		if node == nil {
-			// depth-first unraveling call by ast.Inspect.  pop an entry.
-			// the entry popped may be nil (see comment at `push`).
-			stack.pop()
+	if *scopesJSON {
+		if err := writeScopes(out, fset, src, filename); err != nil {
+			scanner.PrintError(os.Stderr, err)
+			setExitCode(1)
 		}
+		return
+	}
 
-		return true
-	})
+	if *diffStrategy {
+		if err := writeStrategyDiff(out, fset, src, filename); err != nil {
+			scanner.PrintError(os.Stderr, err)
+			setExitCode(1)
+		}
+		return
+	}
 
-	if len(errs) == 0 {
-		return nil
+	if *showGuesses {
+		if err := writeGuesses(out, fset, src, filename); err != nil {
+			scanner.PrintError(os.Stderr, err)
+			setExitCode(1)
+		}
+		return
 	}
-	return errs
-}
 
-func isValidIdent(w string) bool {
-	// https://golang.org/ref/spec#identifier
-	if len(w) == 0 {
-		return false
+	// Keep the following in sync with test code.
+	var result *dedup.Result
+	if pf := prefetched.lookup(src, filename); pf != nil {
+		result, err = pf.result, pf.err
+	} else {
+		result, err = processFile(fset, src, filename)
 	}
-	isLetter := func(r rune) bool {
-		return unicode.In(r, unicode.Lu, unicode.Ll, unicode.Lt, unicode.Lm, unicode.Lo)
+
+	// '-count' and '-check' report the imports that the other modes remove,
+	// from the same result.
+	if mode == modeCount || mode == modeCheck {
+		if err == nil && mode == modeCount {
+			duplicateCount += len(result.RemovedSpecs)
+			if len(result.RemovedSpecs) != 0 {
+				anyChanged = true
+			}
+		} else if err == nil {
+			err = writeCheck(out, result.RemovedSpecs)
+		}
+		if err != nil {
+			var buf bytes.Buffer
+			scanner.PrintError(&buf, err)
+			errOut.Write(buf.Bytes())
+			setExitCode(1)
+		}
+		return
 	}
-	isNumber := func(r rune) bool {
-		return unicode.In(r, unicode.Nd)
+	if result != nil {
+		for _, w := range result.Warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+		}
+		os.Stderr.Write(result.AST)
 	}
-	for i, r := range w {
-		switch i {
-		case 0:
-			if !(isLetter(r) || r == '_') {
-				return false
-			}
-		default:
-			if !(isLetter(r) || r == '_' || isNumber(r)) {
-				return false
+	if reporter != nil || junitFileReporter != nil {
+		r := newFileReport(filename, result, err)
+		if junitFileReporter != nil {
+			junitFileReporter.Record(ioutil.Discard, r)
+		}
+		if reporter != nil {
+			if err := reporter.Record(out, r); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				setExitCode(1)
 			}
 		}
 	}
-	return true
-}
-
-func isGoKeyword(w string) bool {
-	switch w {
-	case "break", "default", "func", "interface", "select",
-		"case", "defer", "go", "map", "struct",
-		"chan", "else", "goto", "package", "switch",
-		"const", "fallthrough", "if", "range", "type",
-		"continue", "for", "import", "return", "var":
-		return true
-	default:
-		return false
+	if *lspEdits && err == nil {
+		if err := writeEdits(out, filename, result); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			setExitCode(1)
+		}
+		return
+	}
+	if err != nil {
+		// Write the file's errors as a unit.
+		var buf bytes.Buffer
+		scanner.PrintError(&buf, err)
+		errOut.Write(buf.Bytes())
+		setExitCode(1)
+		return
+	}
+	if *diagnose || reporter != nil && !mode.writes() {
+		return
+	}
+	err = writeOutput(out, stdin, src, result.Output, filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		setExitCode(1)
+		return
 	}
 }
 
-type InvalidIdentError struct {
-	position token.Position
-	from, to string
-}
-
-var _ error = (*InvalidIdentError)(nil)
-
-func (s *InvalidIdentError) Error() string {
-	return fmt.Sprintf("%s: cannot rewrite %s -> %s: identifier %[3]s is not a valid identifier; "+
-		"specify a mapping for the import using '-m'", s.position, s.from, s.to)
+// options returns the dedup options given by the flags.
+func options() dedup.Options {
+	var resolve func(string, string) (string, bool)
+	if *resolveNames {
+		resolve = resolver.resolve
+	}
+	return dedup.Options{
+		Strategy:            *strategy,
+		Strict:              *strict,
+		PreferExplicit:      *explicit,
+		IgnoreDirectives:    *ignoreDirectives,
+		PinMarker:           *pinMarker,
+		KeepPathRegexp:      keepPathRegexp,
+		DistinctAliases:     *distinctAliases,
+		CollapseBlank:       *collapse,
+		NameFilter:          nameFilterRegexp,
+		ImportOnly:          *importOnly,
+		ImportsOnlyParse:    *importsOnlyParse,
+		AllErrors:           *allErrors,
+		PackageNames:        pkgNames.m,
+		Resolver:            resolve,
+		Canonicalize:        canonical.m,
+		Region:              region,
+		KeepDocReferenced:   *keepDocRef,
+		RewriteGenerate:     *rewriteGen,
+		OnConflict:          *onConflict,
+		FixNameCollisions:   *fixCollisions,
+		MaxErrors:           *maxErrors,
+		KeepSlot:            *keepSlot,
+		KeepCommentFrom:     *keepCommentFrom,
+		Comments:            *comments,
+		TrimTrailingComment: *trimComment,
+		Simplify:            *simplifyAST,
+		OrderSentinel:       *sentinel,
+		TabWidth:            *tabWidth,
+		UseSpaces:           *useSpaces,
+		DumpAST:             *dumpAST,
+	}
 }
 
-type GoKeywordError struct {
-	position token.Position
-	from, to string
+// processFile removes duplicate imports from the file with the options given
+// by the flags.
+func processFile(fset *token.FileSet, src []byte, filename string) (*dedup.Result, error) {
+	return dedup.ProcessFile(fset, src, filename, options())
 }
 
-var _ error = (*GoKeywordError)(nil)
-
-func (s *GoKeywordError) Error() string {
-	return fmt.Sprintf("%s: cannot rewrite %s -> %s: identifier %[3]s is a go keyword; "+
-		"specify a mapping for the import using '-m'", s.position, s.from, s.to)
+// validStrategy reports whether name is the name of a registered strategy.
+func validStrategy(name string) bool {
+	for _, n := range dedup.StrategyNames() {
+		if n == name {
+			return true
+		}
+	}
+	return false
 }
 
-type ScopeError struct {
-	position token.Position
-	from, to string
+func parserMode() parser.Mode {
+	if *allErrors {
+		return parser.ParseComments | parser.AllErrors
+	}
+	return parser.ParseComments
 }
 
-var _ error = (*ScopeError)(nil)
-
-func (s *ScopeError) Error() string {
-	return fmt.Sprintf("%s: cannot rewrite %s -> %s: identifier %[3]s in scope might not be referring to the import",
-		s.position, s.from, s.to)
+// writeScopes writes the scopes in the file as a JSON object on a single line.
+func writeScopes(out io.Writer, fset *token.FileSet, src []byte, filename string) error {
+	file, err := parser.ParseFile(fset, filename, src, parserMode())
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(out).Encode(struct {
+		Filename string          `json:"filename"`
+		Scope    dedup.ScopeJSON `json:"scope"`
+	}{filename, dedup.Scopes(fset, file)})
 }
 
-type MultiError []error
-
-var _ error = (MultiError)(nil)
+// writeStrategyDiff writes a line for each group of duplicate imports in the
+// file for which the strategy specified by '-keep' keeps a different import
+// than the default "unnamed" strategy.
+func writeStrategyDiff(out io.Writer, fset *token.FileSet, src []byte, filename string) error {
+	keptSpecs := func(strategy string) (map[string]token.Position, error) {
+		opts := options()
+		opts.Strategy = strategy
+		dups, err := dedup.Duplicates(fset, src, filename, opts)
+		if err != nil {
+			return nil, err
+		}
+		kept := make(map[string]token.Position) // by path
+		for _, s := range dups {
+			kept[s.Path] = s.KeptPosition
+		}
+		return kept, nil
+	}
 
-func (m MultiError) Error() string {
-	if len(m) == 0 {
-		panic("[code bug] MultiError has zero errors") // don't make such a MultiError in the first place.
+	chosen, err := keptSpecs(*strategy)
+	if err != nil {
+		return err
+	}
+	def, err := keptSpecs("unnamed")
+	if err != nil {
+		return err
 	}
-	var buf bytes.Buffer
-	for i, e := range m {
-		buf.WriteString(e.Error())
-		if i != len(m)-1 {
-			buf.WriteString("\n")
+	var paths []string
+	for path, pos := range chosen {
+		if d, ok := def[path]; ok && d.Offset != pos.Offset {
+			paths = append(paths, path)
 		}
 	}
-	return buf.String()
+	sort.Slice(paths, func(i, j int) bool { return chosen[paths[i]].Offset < chosen[paths[j]].Offset })
+	for _, path := range paths {
+		fmt.Fprintf(out, "%s: strategy %s keeps this import of %q; strategy unnamed keeps the one on line %d\n",
+			chosen[path], *strategy, path, def[path].Line)
+	}
+	return nil
 }
 
-// trimImportDecls trims the file's import declarations based on the import
-// specs present in file.Imports.
-func trimImportDecls(file *ast.File) {
-	lookup := make(map[*ast.ImportSpec]struct{}, len(file.Imports))
-	for _, im := range file.Imports {
-		lookup[im] = struct{}{}
+// writeCheck writes a line for a file if it has duplicate imports, given by
+// the specs removed from it, with the position of the first duplicate and the
+// paths imported more than once, and sets the exit code to 1.
+func writeCheck(out io.Writer, dups []dedup.SpecInfo) error {
+	if len(dups) == 0 {
+		return nil
 	}
-
-	for i := range file.Decls {
-		genDecl, ok := file.Decls[i].(*ast.GenDecl)
-		if !ok || genDecl.Tok != token.IMPORT {
-			continue
+	anyChanged = true
+	setExitCode(1)
+
+	first := dups[0].Position
+	seen := make(map[string]bool)
+	var paths []string
+	for _, s := range dups {
+		if s.Position.Offset < first.Offset {
+			first = s.Position
 		}
-		var keep []ast.Spec // type is generic so that we can use in assignment below.
-		for _, spec := range genDecl.Specs {
-			im, ok := spec.(*ast.ImportSpec)
-			if !ok {
-				// WTF, doesn't match godoc
-				panicf("expected ImportSpec")
-			}
-			if _, ok := lookup[im]; ok {
-				// was not removed during deduping,
-				// so append it to our list of imports to keep.
-				keep = append(keep, spec)
-			}
+		if !seen[s.Path] {
+			seen[s.Path] = true
+			paths = append(paths, strconv.Quote(s.Path))
 		}
-		genDecl.Specs = keep
-		file.Decls[i] = genDecl
 	}
+	_, err := fmt.Fprintf(out, "%s:%d: duplicate imports of %s\n", first.Filename, first.Line, strings.Join(paths, ", "))
+	return err
+}
 
-	var nonEmptyDecls []ast.Decl
-	for _, decl := range file.Decls {
-		genDecl, ok := decl.(*ast.GenDecl)
-		if !ok || genDecl.Tok != token.IMPORT {
-			nonEmptyDecls = append(nonEmptyDecls, decl)
-			continue
-		}
-		if len(genDecl.Specs) != 0 {
-			nonEmptyDecls = append(nonEmptyDecls, decl)
+// writeGuesses writes a line for each import in the file with the package
+// name used for it and the source of the name: "explicit" for named imports,
+// or one of the sources returned by dedup.ResolvePackageName.
+func writeGuesses(out io.Writer, fset *token.FileSet, src []byte, filename string) error {
+	file, err := parser.ParseFile(fset, filename, src, parser.ImportsOnly)
+	if err != nil {
+		return err
+	}
+	srcDir := filepath.Dir(filename)
+	for _, spec := range file.Imports {
+		var name, source string
+		if spec.Name != nil {
+			name, source = spec.Name.Name, "explicit"
+		} else {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			name, source = dedup.ResolvePackageName(path, srcDir, options())
 		}
+		fmt.Fprintf(out, "%s: %s -> %s (%s)\n", fset.Position(spec.Pos()), spec.Path.Value, name, source)
 	}
-	file.Decls = nonEmptyDecls
+	return nil
 }
 
-// markDuplicates returns the import specs with a removal status marked.
-// Neither the input slice nor its elements are modified.
-func markDuplicates(input []*ast.ImportSpec) []*ImportSpec {
-	imports := make([]*ImportSpec, len(input))
-	for i := range input {
-		imports[i] = &ImportSpec{input[i], false, nil}
+// mappingWarnings returns a warning for each '-m' mapping whose package name
+// is implausible for the import path, which may be a typo. The warnings are
+// sorted by import path.
+func mappingWarnings() []string {
+	var paths []string
+	for p := range pkgNames.m {
+		paths = append(paths, p)
 	}
+	sort.Strings(paths)
 
-	importPaths := make(map[string][]*ImportSpec)
-	for _, im := range imports {
-		spec := im.spec
-		// NOTE: The panics below indicate conditions that should have been
-		// caught already by the parser.
-		if spec.Path.Kind != token.STRING {
-			panicf("import path %s is not a string", spec.Path.Value)
-		}
-		// skip dot and side effect imports. for now, let's assume it's okay
-		// to have both these coexist with regular imports. In fact, it looks
-		// like it's necessary to not remove _ imports; that's the only way both _
-		// and regular import can be used together in a file.
-		if spec.Name != nil && (spec.Name.Name == "." || spec.Name.Name == "_") {
-			continue
-		}
-		// normalize `fmt` vs. "fmt", for instance
-		path, err := normalizeImportPath(spec.Path.Value)
-		if err != nil {
-			// wasn't a valid string?
-			panicf("unquoting path: %s", err)
+	var warnings []string
+	for _, p := range paths {
+		name, guess := pkgNames.m[p], dedup.GuessPackageName(p)
+		if !plausibleName(name, guess) {
+			warnings = append(warnings, fmt.Sprintf("-m %s=%s: package name differs from %s, the name guessed from the path", p, name, guess))
 		}
-		importPaths[path] = append(importPaths[path], im)
 	}
+	return warnings
+}
 
-	duplicateImportPaths := make(map[string][]*ImportSpec)
-	for p, v := range importPaths {
-		if len(v) > 1 {
-			duplicateImportPaths[p] = v
+// plausibleName reports whether name is a plausible package name for a
+// package whose name is guessed to be guess. Ignoring case, it is if name
+// contains or is contained in guess or a "-" or "_" separated part of guess,
+// as in "clientk8s" for "k8s-client", or if name abbreviates guess, as in
+// "fe" for "frontend".
+func plausibleName(name, guess string) bool {
+	name = strings.ToLower(name)
+	guess = strings.ToLower(guess)
+	if name == "" || guess == "" {
+		return false
+	}
+	parts := strings.FieldsFunc(guess, func(r rune) bool { return r == '-' || r == '_' })
+	for _, part := range append(parts, guess) {
+		if strings.Contains(part, name) || strings.Contains(name, part) {
+			return true
+		}
+	}
+	if name[0] != guess[0] {
+		return false
+	}
+	// Is name a subsequence of guess?
+	i := 0
+	for j := 0; i < len(name) && j < len(guess); j++ {
+		if name[i] == guess[j] {
+			i++
 		}
 	}
+	return i == len(name)
+}
 
-	for _, v := range duplicateImportPaths {
-		var keepIdx int
+// The files to handle, as restricted by '-since'. If sinceTime is non-zero,
+// only files modified after it are handled. If sinceFiles is non-nil, only
+// files in it are handled; the keys are absolute paths.
+var (
+	sinceTime  time.Time
+	sinceFiles map[string]bool
+)
 
-		switch *strategy {
-		case "unnamed":
-			// Find the index of the first unnamed import.
-			// That's the one we will keep.
-			idx := -1
-			for i := range v {
-				if v[i].spec.Name == nil {
-					idx = i
-					break
-				}
-			}
-			keepIdx = idx
-			if keepIdx == -1 {
-				// no unnamed import exists. fall back to keeping
-				// the first one.
-				keepIdx = 0
-			}
-		case "first":
-			keepIdx = 0
-		case "comment":
-			// Find the index of the first import with either a doc comment
-			// or line comment.
-			idx := -1
-			for i := range v {
-				if v[i].spec.Comment != nil || v[i].spec.Doc != nil {
-					idx = i
-					break
-				}
-			}
-			keepIdx = idx
-			if keepIdx == -1 {
-				// use first one.
-				keepIdx = 0
-			}
-		case "named":
-			// Find the shortest named import.
-			// If multiple exist with the same shortest length, we keep the
-			// first of those.
-			idx := -1
-			length := -1
-			for i := range v {
-				if v[i].spec.Name != nil && (len(v[i].spec.Name.Name) < length || length == -1) {
-					idx = i
-					length = len(v[i].spec.Name.Name)
-				}
-			}
-			keepIdx = idx
-			if keepIdx == -1 {
-				// no named import existed at all.
-				// fall back to keeping the first one.
-				keepIdx = 0
+// setSince sets up sinceTime or sinceFiles from the value of '-since', which
+// is either an RFC 3339 timestamp or a git revision. For a revision, the
+// files are those changed since the revision, and untracked files that
+// aren't ignored. If the git command isn't found, it prints a warning and no
+// files are filtered out; any other failure of git, such as for a bad
+// revision or outside a repository, is returned as an error.
+func setSince(val string) error {
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		sinceTime = t
+		return nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: cannot list files changed since %s, handling all files: %s\n", val, err)
+		return nil
+	}
+	files := make(map[string]bool)
+	for _, args := range [][]string{
+		// Check the revision first, since outside a repository, git diff
+		// compares paths instead.
+		{"rev-parse", "--verify", "--end-of-options", val + "^{commit}"},
+		{"diff", "--name-only", "--relative", val, "--"},
+		{"ls-files", "--others", "--exclude-standard"},
+	} {
+		data, err := exec.Command("git", args...).Output()
+		if err != nil {
+			msg := err.Error()
+			if e, ok := err.(*exec.ExitError); ok && len(e.Stderr) != 0 {
+				msg = strings.TrimSpace(string(e.Stderr))
 			}
+			return fmt.Errorf("cannot list files changed since %s: git %s: %s", val, args[0], msg)
 		}
-
-		// mark imports for removal
-		for i := 0; i < len(v); i++ {
-			if i != keepIdx {
-				v[i].remove = true
-				v[i].subsumedBy = v[keepIdx].spec
+		if args[0] == "rev-parse" {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				files[absPath(line)] = true
 			}
 		}
 	}
-
-	return imports
-}
-
-func normalizeImportPath(p string) (string, error) {
-	return strconv.Unquote(p)
+	sinceFiles = files
+	return nil
 }
 
-func packageNameForImport(spec *ast.ImportSpec, srcDir string) string {
-	if spec.Name != nil {
-		// named import
-		return spec.Name.Name
+// readFileList returns the Go files listed in the '-filelist' file, or stdin
+// for "-", one per line. Empty lines and lines that don't name .go files, such
+// as the other files in the output of 'git diff --name-only', are skipped.
+func readFileList(name string) ([]string, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(name)
 	}
-	path, err := normalizeImportPath(spec.Path.Value)
 	if err != nil {
-		// wasn't a valid string?
-		panicf("unquoting path: %s", err)
+		return nil, fmt.Errorf("reading -filelist: %s", err)
+	}
+	var files []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, ".go") {
+			files = append(files, line)
+		}
 	}
-	return packageNameForPath(path, srcDir)
+	return files, nil
 }
 
-func packageNameForPath(p string, srcDir string) string {
-	// Use the mapping first.
-	if name, ok := pkgNames.m[p]; ok {
-		return name
-	}
-	// Try build.Import. Ignore the error; pkg could be non-nil
-	// with sufficient information we care about regardless of the error.
-	pkg, _ := build.Import(p, srcDir, build.AllowBinary|build.ImportComment)
-	if pkg != nil && pkg.Name != "" {
-		return pkg.Name
+func absPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
 	}
-	// Guess it.
-	return guessPackageName(p)
+	return p
 }
 
-// Guesses the package name based on the import path.
-// The returned string may not be a valid identifier (and hence not a valid
-// package name).
-func guessPackageName(p string) string {
-	// as an example, this can do:
-	// "foo.org/blah/go-yaml.v2" -> "yaml"
-	return guessPackageName_(p, true)
+// checkWritable returns an error if filename isn't an existing regular file
+// that can be opened for writing.
+func checkWritable(filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", filename)
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
 }
 
-var (
-	modulevn = regexp.MustCompile(`^v\d+$`)
-	dotvn    = regexp.MustCompile(`\.v\d+$`)
-)
-
-func guessPackageName_(p string, trimVersion bool) string {
-	sidx := strings.LastIndex(p, "/")
-	if sidx == -1 {
-		return p
-	}
-
-	last := p[sidx+1:]
-
-	// Order matters.
-	switch {
-	case trimVersion && modulevn.MatchString(last):
-		// foo.org/blah/go-yaml/v2
-		idx := strings.LastIndex(p, "/")
-		if idx == -1 {
-			panicf("[code bug] should have '/' in string: %s", p)
-		}
-		return guessPackageName_(p[:idx], false)
-	case trimVersion && dotvn.MatchString(last):
-		// foo.org/blah/go-yaml.v2
-		idx := strings.LastIndex(p, ".")
-		if idx == -1 {
-			panicf("[code bug] should have '.' in string: %s", p)
-		}
-		return guessPackageName_(p[:idx], false)
-	case strings.HasPrefix(last, "go-"):
-		// foo.org/go-yaml
-		return strings.TrimPrefix(last, "go-")
-	case strings.HasSuffix(last, "-go"):
-		// foo.org/yaml-go
-		return strings.TrimSuffix(last, "-go")
-	default:
-		return last
+// visited is the set of files that have been handled, keyed by absolute path
+// with symlinks resolved.
+var visited = make(map[string]bool)
+
+// firstVisit records the file as visited and reports whether it was the first
+// visit. It ensures that a file is handled only once, even if it is passed
+// more than once, directly or through overlapping directories or symlinks.
+func firstVisit(filename string) bool {
+	key := filename
+	if p, err := filepath.EvalSymlinks(key); err == nil {
+		key = p
 	}
+	key = absPath(key)
+	if visited[key] {
+		return false
+	}
+	visited[key] = true
+	return true
 }
 
-type ImportSpec struct {
-	spec       *ast.ImportSpec // this spec
-	remove     bool            // indicator for removal
-	subsumedBy *ast.ImportSpec // the spec replacing this spec; nil if remove==false
+func handleDir(fset *token.FileSet, p string, out io.Writer) {
+	walkDir(fset, p, false, out)
 }
 
-func panicf(format string, v ...interface{}) {
-	s := fmt.Sprintf(format, v...)
-	panic(s)
+// isPattern reports whether the path argument is a pattern like the go
+// command's "./...", which matches a directory and its subdirectories.
+func isPattern(arg string) bool {
+	return arg == "..." || strings.HasSuffix(arg, "/...") || strings.HasSuffix(arg, string(filepath.Separator)+"...")
 }
 
-func handleFile(fset *token.FileSet, stdin bool, filename string, out io.Writer) {
-	var src []byte
-	var err error
-	if stdin {
-		src, err = ioutil.ReadAll(os.Stdin)
-	} else {
-		src, err = ioutil.ReadFile(filename)
+// handlePattern handles the Go files in the directories matched by the
+// pattern: the directory before the "..." and its subdirectories, except, as
+// with the go command, testdata directories, directories beginning with "."
+// or "_", and, unless '-vendor' is set, vendor directories.
+func handlePattern(fset *token.FileSet, pattern string, out io.Writer) {
+	dir := strings.TrimSuffix(pattern, "...")
+	if len(dir) > 1 {
+		dir = strings.TrimRight(dir, "/"+string(filepath.Separator))
 	}
+	if dir == "" {
+		dir = "."
+	}
+	info, err := os.Stat(dir)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		setExitCode(1)
 		return
 	}
-
-	// Keep the following in sync with test code.
-	changedFile, err := processFile(fset, src, filename)
-	if err != nil {
-		scanner.PrintError(os.Stderr, err)
+	if !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "invalid pattern %s: %s is not a directory\n", pattern, dir)
 		setExitCode(1)
 		return
 	}
-	res := src
-	if changedFile != nil {
-		var buf bytes.Buffer
-		err := format.Node(&buf, fset, changedFile)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			setExitCode(1)
-			return
-		}
-		res = buf.Bytes()
-	}
-	err = writeOutput(out, src, res, filename)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		setExitCode(1)
-		return
+	walkDir(fset, dir, true, out)
+}
+
+// skipPatternDir reports whether directories with the name are skipped by
+// patterns.
+func skipPatternDir(name string) bool {
+	if name == "vendor" {
+		return !*vendor
 	}
+	return name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
 }
 
-func handleDir(fset *token.FileSet, p string) {
+// walkDir handles the Go files in the directory p and its subdirectories, in
+// path order. If pattern is set, the directories skipped by patterns are
+// skipped. With '-p', the files are processed concurrently ahead of being
+// handled.
+func walkDir(fset *token.FileSet, p string, pattern bool, out io.Writer) {
+	outRoot = p
+	var files []string
 	if err := filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if info.IsDir() && pattern && path != p && skipPatternDir(info.Name()) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() && mode == modeOutDir && absPath(path) == absPath(*outDir) {
+			// don't process the results of earlier files.
+			return filepath.SkipDir
+		}
+		if info.IsDir() && *maxDepth >= 0 && path != p {
+			rel, err := filepath.Rel(p, path)
+			if err != nil {
+				return err
+			}
+			if strings.Count(rel, string(filepath.Separator))+1 > *maxDepth {
+				return filepath.SkipDir
+			}
+		}
 		if !isGoFile(info) {
 			return nil
 		}
-		handleFile(fset, false, path, os.Stdout)
+		files = append(files, path)
 		return nil
 	}); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		setExitCode(1)
 	}
+
+	// The files are checked before any are prefetched, so that skipped files
+	// are never read. The results of the checks are reported in order, as
+	// the files are handled.
+	checks := make([]skipCheck, len(files))
+	var queued []string
+	for i, f := range files {
+		checks[i] = checkSkip(f)
+		if !checks[i].skip {
+			queued = append(queued, f)
+		}
+	}
+	if *parallel > 1 && prefetchable() {
+		prefetched = startPrefetch(fset, queued, *parallel)
+		defer func() { prefetched = nil }()
+	}
+	for i, f := range files {
+		if checks[i].report() {
+			continue
+		}
+		handleCheckedFile(fset, false, f, out)
+		if prefetched != nil {
+			prefetched.release(f)
+		}
+	}
 }
 
-func writeOutput(out io.Writer, src, res []byte, filename string) error {
+// prefetchable reports whether handleFile processes files with processFile,
+// so that the files can be prefetched, as opposed to only inspecting them.
+func prefetchable() bool {
+	return !*scopesJSON && !*diffStrategy && !*showGuesses
+}
+
+// outputMode is what the command does with the result for each file.
+type outputMode int
+
+const (
+	modeStdout    outputMode = iota // print the result to stdout; the default
+	modeList                        // -l: list the files with duplicate imports
+	modeDiff                        // -d: print the diff of changes
+	modeWrite                       // -w: overwrite the files
+	modeWriteDiff                   // -w -d: overwrite the files and print the diff of changes
+	modeDryRun                      // -dry-run: process files, but print and write nothing
+	modeCheck                       // -check: print the files with duplicate imports, without rewriting them
+	modeCount                       // -count: print the number of duplicate imports, without rewriting files
+	modeOutDir                      // -out-dir: write the results under another directory
+)
+
+// writes reports whether files are written in the mode.
+func (m outputMode) writes() bool {
+	return m == modeWrite || m == modeWriteDiff
+}
+
+// mode is the output mode for the command invocation, resolved from the flags
+// by resolveMode.
+var mode = modeStdout
+
+// resolveMode returns the output mode specified by the flags. At most one of
+// -l, -d, -w, -check, -count, -out-dir, and -dry-run may be specified, except
+// that -w may be used with -d, -l, or both, as with gofmt; in particular, -l
+// and -d alone never write files. With -w, -l lists the files written, which
+// writeOutput handles, so it doesn't affect the mode.
+func resolveMode() (outputMode, error) {
+	var set []string
+	m := modeStdout
+	for _, f := range []struct {
+		name string
+		on   bool
+		mode outputMode
+	}{
+		{"-l", *list && !*overwrite, modeList},
+		{"-d", *diff, modeDiff},
+		{"-w", *overwrite, modeWrite},
+		{"-dry-run", *dryRun, modeDryRun},
+		{"-check", *check, modeCheck},
+		{"-count", *count, modeCount},
+		{"-out-dir", *outDir != "", modeOutDir},
+	} {
+		if f.on {
+			set = append(set, f.name)
+			m = f.mode
+		}
+	}
+	if len(set) == 2 && *overwrite && *diff {
+		return modeWriteDiff, nil
+	}
+	if len(set) > 1 {
+		return 0, fmt.Errorf("cannot use %s together", strings.Join(set, " and "))
+	}
+	return m, nil
+}
+
+func writeOutput(out io.Writer, stdin bool, src, res []byte, filename string) error {
 	// Copied from processFile in cmd/gofmt.
-	if !bytes.Equal(res, src) {
-		if *list {
+	changed := !bytes.Equal(res, src)
+	if stdin && mode.writes() {
+		// filename is the '-stdin-filename' file, which main has checked to
+		// be writable. Its content, rather than the stdin content, is what
+		// the result replaces: it is compared with the result, backed up,
+		// and restored by '-build-check'.
+		orig, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		src = orig
+		changed = !bytes.Equal(res, src)
+	}
+	if changed {
+		anyChanged = true
+	}
+
+	switch mode {
+	case modeStdout:
+		if !changed && *quietUnchanged {
+			return nil
+		}
+		_, err := out.Write(res)
+		return err
+	case modeList:
+		if changed {
 			fmt.Fprintln(out, filename)
 		}
-		// TODO: filename can be gibberish like "<stdin>" here, but -w is not
-		// allowed for stdin in main, hence why this doesn't blow up. clean this
-		// up.
-		if *overwrite {
+	case modeDiff:
+		if changed {
+			return writeDiff(out, src, res, filename)
+		}
+	case modeWrite, modeWriteDiff:
+		if changed {
 			fi, err := os.Stat(filename)
 			if err != nil {
 				return err
@@ -860,24 +1566,61 @@ func writeOutput(out io.Writer, src, res []byte, filename string) error {
 			if err != nil {
 				return err
 			}
-		}
-		if *diff {
-			data, err := cmdDiff(src, res, filename)
-			if err != nil {
-				return fmt.Errorf("computing diff: %s", err)
+			if *buildCheck {
+				recordWrite(filename, src, perm)
+			}
+			if (*printChg || *list) && !*buildCheck {
+				// With '-build-check', checkBuilds prints the files
+				// that remain changed.
+				fmt.Fprintln(out, filename)
+			}
+			modifiedDirs[filepath.Dir(filename)] = true
+			if mode == modeWriteDiff {
+				return writeDiff(out, src, res, filename)
 			}
-			fmt.Printf("diff -u %s %s\n", filepath.ToSlash(filename+".orig"), filepath.ToSlash(filename))
-			out.Write(data)
 		}
+	case modeOutDir:
+		if changed || *copyUnchanged {
+			return writeOutDir(filename, res)
+		}
+	case modeDryRun:
+		// nothing to do
 	}
 
-	if !*list && !*overwrite && !*diff {
-		_, err := out.Write(res)
-		if err != nil {
-			return nil
-		}
+	return nil
+}
+
+// outRoot is the path argument that the file being handled was found in, or
+// the directory of the file if the file itself is the argument. It is used
+// to place results with '-out-dir'.
+var outRoot string
+
+// writeOutDir writes res, the result for filename, to the path under
+// '-out-dir' that mirrors the path of filename relative to outRoot. The file
+// has the same permissions as filename.
+func writeOutDir(filename string, res []byte) error {
+	rel, err := filepath.Rel(outRoot, filename)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(*outDir, rel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
 	}
+	return ioutil.WriteFile(dst, res, fi.Mode().Perm())
+}
 
+func writeDiff(out io.Writer, src, res []byte, filename string) error {
+	data, err := cmdDiff(src, res, filename)
+	if err != nil {
+		return fmt.Errorf("computing diff: %s", err)
+	}
+	fmt.Fprintf(out, "diff -u %s %s\n", filepath.ToSlash(filename+".orig"), filepath.ToSlash(filename))
+	out.Write(data)
 	return nil
 }
 
@@ -948,18 +1691,12 @@ func replaceTempFilename(diff []byte, filename string) ([]byte, error) {
 	if len(bs) < 3 {
 		return nil, fmt.Errorf("got unexpected diff for %s", filename)
 	}
-	// Preserve timestamps.
-	var t0, t1 []byte
-	if i := bytes.LastIndexByte(bs[0], '\t'); i != -1 {
-		t0 = bs[0][i:]
-	}
-	if i := bytes.LastIndexByte(bs[1], '\t'); i != -1 {
-		t1 = bs[1][i:]
-	}
+	// Drop the timestamps, which are those of the temporary files, so that
+	// the output is the same across runs.
 	// Always print filepath with slash separator.
 	f := filepath.ToSlash(filename)
-	bs[0] = []byte(fmt.Sprintf("--- %s%s", f+".orig", t0))
-	bs[1] = []byte(fmt.Sprintf("+++ %s%s", f, t1))
+	bs[0] = []byte(fmt.Sprintf("--- %s", f+".orig"))
+	bs[1] = []byte(fmt.Sprintf("+++ %s", f))
 	return bytes.Join(bs, []byte{'\n'}), nil
 }
 
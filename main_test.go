@@ -1,15 +1,28 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
-	"go/format"
 	"go/scanner"
 	"go/token"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/nishanths/dedupimport/dedup"
 )
 
 func outPath(p string) string { return strings.TrimSuffix(p, ".go") + ".out" }
@@ -57,6 +70,78 @@ func parseFlags(p string) {
 			*strategy = args[i]
 		case "-i":
 			*importOnly = true
+		case "-collapse-redundant-blank":
+			*collapse = true
+		case "-comment-ignore-directives":
+			*ignoreDirectives = true
+		case "-keep-doc-referenced":
+			*keepDocRef = true
+		case "-rewrite-generate":
+			*rewriteGen = true
+		case "-name-filter":
+			i++
+			nameFilterRegexp = regexp.MustCompile(args[i])
+		case "-keep-path-regexp":
+			i++
+			keepPathRegexp = regexp.MustCompile(args[i])
+		case "-pin-marker":
+			i++
+			*pinMarker = args[i]
+		case "-keep-slot":
+			i++
+			*keepSlot = args[i]
+		case "-keep-comment-from":
+			i++
+			*keepCommentFrom = args[i]
+		case "-trim-trailing-comment":
+			*trimComment = true
+		case "-comments":
+			i++
+			*comments = args[i]
+		case "-imports-only-parse":
+			*importsOnlyParse = true
+		case "-treat-aliases-as-distinct":
+			*distinctAliases = true
+		case "-on-conflict":
+			i++
+			*onConflict = args[i]
+		case "-fix-name-collisions":
+			*fixCollisions = true
+		case "-strict-strategy":
+			*strict = true
+		case "-prefer-explicit-on-conflict":
+			*explicit = true
+		case "-tabwidth":
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil {
+				panic(fmt.Sprintf("bad -tabwidth: %s", err))
+			}
+			*tabWidth = n
+		case "-simplify":
+			*simplifyAST = true
+		case "-use-spaces":
+			*useSpaces = true
+		case "-order-sentinel":
+			i++
+			*sentinel = args[i]
+		case "-max-errors":
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil {
+				panic(fmt.Sprintf("bad -max-errors: %s", err))
+			}
+			*maxErrors = n
+		case "-canonicalize":
+			i++
+			if err := canonical.Set(args[i]); err != nil {
+				panic(err)
+			}
+		case "-region":
+			i++
+			if err := region.Set(args[i]); err != nil {
+				panic(err)
+			}
 		default:
 			panic("unhandled flag")
 		}
@@ -67,6 +152,71 @@ func parseFlags(p string) {
 func resetFlags() {
 	*strategy = "unnamed"
 	*importOnly = false
+	*explicit = false
+	*strict = false
+	*comments = "keep"
+	*trimComment = false
+	*keepSlot = "kept"
+	*pinMarker = ""
+	keepPathRegexp = nil
+	nameFilterRegexp = nil
+	*resolveNames = false
+	*diffStrategy = false
+	*keepCommentFrom = "slot"
+	*rewriteGen = false
+	*keepDocRef = false
+	*ignoreDirectives = false
+	*collapse = false
+	*sentinel = ""
+	*tabWidth = 8
+	*useSpaces = false
+	*dumpAST = false
+	*simplifyAST = false
+	region = dedup.Region{}
+	canonical.m = nil
+	*maxErrors = 0
+	*skipSymlinks = true
+	*fixCollisions = false
+	*onConflict = "skip-file"
+	*distinctAliases = false
+	*importsOnlyParse = false
+	*maxSize = 0
+	*maxDepth = -1
+	*vendor = false
+	*parallel = runtime.NumCPU()
+	*generated = false
+	*overwrite = false
+	*quietUnchanged = false
+	*list = false
+	*check = false
+	*count = false
+	duplicateCount = 0
+	*diff = false
+	*dryRun = false
+	*outDir = ""
+	*copyUnchanged = false
+	outRoot = ""
+	*stdinName = ""
+	*junitFile = ""
+	*reportFmt = "text"
+	reporter = nil
+	junitFileReporter = nil
+	*jsonReport = false
+	mode = modeStdout
+	*printChg = false
+	*buildCheck = false
+	writtenFiles = make(map[string]map[string]writtenFile)
+	writtenOrder = nil
+	*countExit = false
+	*scopesJSON = false
+	*diagnose = false
+	visited = make(map[string]bool)
+	modifiedDirs = make(map[string]bool)
+	errOut = os.Stderr
+	sinceTime = time.Time{}
+	sinceFiles = nil
+	exitCode = 0
+	anyChanged = false
 }
 
 func TestAll(t *testing.T) {
@@ -75,12 +225,14 @@ func TestAll(t *testing.T) {
 		"testdata/cannot.go",
 		"testdata/example.go",
 		"testdata/named.go",
+		"testdata/named-kept.go",
 		"testdata/comment.go",
 		"testdata/first1.go",
 		"testdata/first2.go",
 		"testdata/removed-comments.go",
 		"testdata/plenty-imports.go",
 		"testdata/dotimport.go",
+		"testdata/dot-duplicates.go",
 		"testdata/space.go",
 		"testdata/space-all1.go",
 		"testdata/space-all2.go",
@@ -94,6 +246,90 @@ func TestAll(t *testing.T) {
 		"testdata/scopeafter1.go",
 		"testdata/scopeafter2.go",
 		"testdata/shortvar.go",
+		"testdata/order-sentinel.go",
+		"testdata/prefer-explicit.go",
+		"testdata/prefer-explicit-stdlib.go",
+		"testdata/group-empty.go",
+		"testdata/group-single.go",
+		"testdata/group-single-emptied.go",
+		"testdata/commented-import.go",
+		"testdata/init-alias.go",
+		"testdata/init-alias-kept.go",
+		"testdata/region.go",
+		"testdata/max-errors.go",
+		"testdata/shortest-path.go",
+		"testdata/shortest-path-canonicalize.go",
+		"testdata/longest.go",
+		"testdata/last.go",
+		"testdata/name-collision.go",
+		"testdata/name-collision-fix.go",
+		"testdata/name-collision-fix-unused.go",
+		"testdata/redundant-alias.go",
+		"testdata/distinct-aliases.go",
+		"testdata/imports-only-parse.go",
+		"testdata/bad-paths.go",
+		"testdata/least-churn.go",
+		"testdata/least-churn-unnamed.go",
+		"testdata/keep-slot.go",
+		"testdata/pin.go",
+		"testdata/pin-multiple.go",
+		"testdata/generic-constraint.go",
+		"testdata/array-len.go",
+		"testdata/generic-instantiation.go",
+		"testdata/three-way-unnamed.go",
+		"testdata/three-way-first.go",
+		"testdata/three-way-comment.go",
+		"testdata/three-way-named.go",
+		"testdata/three-way-least-churn.go",
+		"testdata/go-defer.go",
+		"testdata/canonicalize.go",
+		"testdata/canonicalize-version.go",
+		"testdata/canonicalize-overlap.go",
+		"testdata/canonicalize-no-imports.go",
+		"testdata/keep-path-regexp.go",
+		"testdata/name-filter.go",
+		"testdata/strict-unnamed.go",
+		"testdata/strict-named.go",
+		"testdata/strict-comment.go",
+		"testdata/strict-ok.go",
+		"testdata/strict-identical-named.go",
+		"testdata/strict-identical-unnamed.go",
+		"testdata/strict-identical-comment.go",
+		"testdata/strict-least-churn.go",
+		"testdata/scope-shadow1.go",
+		"testdata/scope-shadow2.go",
+		"testdata/scope-typeswitch.go",
+		"testdata/paren-selector.go",
+		"testdata/scope-range.go",
+		"testdata/scope-init.go",
+		"testdata/scope-init-after.go",
+		"testdata/scope-select.go",
+		"testdata/scope-self-decl.go",
+		"testdata/misc-decls.go",
+		"testdata/build-constraint.go",
+		"testdata/use-spaces.go",
+		"testdata/blank-regular.go",
+		"testdata/blank-duplicates.go",
+		"testdata/blank-named.go",
+		"testdata/blank-named-collapse.go",
+		"testdata/bom.go",
+		"testdata/cgo.go",
+		"testdata/collapse-blank.go",
+		"testdata/comment-directives.go",
+		"testdata/keep-doc-referenced.go",
+		"testdata/rewrite-generate.go",
+		"testdata/comments-keep.go",
+		"testdata/comments-merge.go",
+		"testdata/comments-drop.go",
+		"testdata/trim-trailing-comment.go",
+		"testdata/import-paren-comment.go",
+		"testdata/import-paren-comment-merge.go",
+		"testdata/raw-string-path.go",
+		"testdata/package-doc.go",
+		"testdata/package-doc2.go",
+		"testdata/simplify.go",
+		"testdata/on-conflict-skip.go",
+		"testdata/on-conflict-partial.go",
 	}
 
 	for _, path := range filenames {
@@ -125,45 +361,2168 @@ func runOneFile(t *testing.T, fset *token.FileSet, path string) {
 		}
 	}
 
-	var outBuf, errBuf bytes.Buffer
-	changedFile, err := processFile(fset, src, path)
+	var errBuf bytes.Buffer
+	result, err := processFile(fset, src, path)
 	if err != nil {
 		scanner.PrintError(&errBuf, err)
 		equalBytes(t, errContent, errBuf.Bytes(), bytes.TrimSpace)
 		return
 	}
 
-	if changedFile != nil {
-		err = format.Node(&outBuf, fset, changedFile)
+	if result.Changed {
+		equalBytes(t, outContent, result.Output, bytes.TrimSpace)
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := ioutil.ReadFile("testdata/example.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "example.go")
+	if err := ioutil.WriteFile(path, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+
+	*maxSize = int64(len(src)) - 1
+	var buf bytes.Buffer
+	handleFile(fset, false, path, &buf)
+	if buf.Len() != 0 {
+		t.Errorf("expected file to be skipped, got output: %s", buf.Bytes())
+	}
+
+	*maxSize = int64(len(src))
+	buf.Reset()
+	handleFile(fset, false, path, &buf)
+	if buf.Len() == 0 {
+		t.Errorf("expected file to be processed")
+	}
+}
+
+func TestPrintChanged(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// example.go has duplicates; first1.out doesn't.
+	for _, name := range []string{"example.go", "first1.out"} {
+		src, err := ioutil.ReadFile(filepath.Join("testdata", name))
 		if err != nil {
-			t.Errorf("unexpected error formatting file: %s", err)
+			t.Fatal(err)
 		}
-		equalBytes(t, outContent, outBuf.Bytes(), bytes.TrimSpace)
+		base := strings.TrimSuffix(name, filepath.Ext(name)) + ".go"
+		if err := ioutil.WriteFile(filepath.Join(dir, base), src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mode = modeWrite
+	*printChg = true
+	var buf bytes.Buffer
+	handleDir(token.NewFileSet(), dir, &buf)
+
+	want := filepath.Join(dir, "example.go") + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("expected: %q, got: %q", want, got)
+	}
+}
+
+func TestMultiErrorSorted(t *testing.T) {
+	resetFlags()
+	src, err := ioutil.ReadFile("testdata/scope1.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	_, err = processFile(fset, src, "testdata/scope1.go")
+	m, ok := err.(dedup.MultiError)
+	if !ok {
+		t.Fatalf("expected MultiError, got %T", err)
+	}
+
+	// Reverse the errors; the output should still be sorted by position.
+	reversed := make(dedup.MultiError, len(m))
+	for i := range m {
+		reversed[len(m)-1-i] = m[i]
+	}
+	want, err := ioutil.ReadFile("testdata/scope1.err")
+	if err != nil {
+		t.Fatal(err)
 	}
+	equalBytes(t, want, []byte(reversed.Error()), bytes.TrimSpace)
 }
 
-func TestGuessPackageName(t *testing.T) {
-	type testcase struct {
-		importPath string
-		expect     string
+func TestDuplicatePaths(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := ioutil.ReadFile("testdata/example.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "example.go")
+	if err := ioutil.WriteFile(path, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.go")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+
+	mode = modeList
+	var buf bytes.Buffer
+	fset := token.NewFileSet()
+	handleFile(fset, false, path, &buf)
+	handleFile(fset, false, filepath.Join(dir, ".", "example.go"), &buf)
+	handleDir(fset, dir, &buf)
+
+	want := path + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("expected: %q, got: %q", want, got)
 	}
-	testcases := []testcase{
-		{"github.com/foo/bar", "bar"},
-		{"github.com/foo/bar/v2", "bar"},
-		{"github.com/foo/go-bar/v2", "bar"},
-		{"github.com/foo/bar-go/v2", "bar"},
-		{"gopkg.in/yaml.v2", "yaml"},
-		{"gopkg.in/go-yaml.v2", "yaml"},
-		{"gopkg.in/yaml-go.v2", "yaml"},
-		{"github.com/nishanths/go-xkcd", "xkcd"},
-		{"github.com/nishanths/lyft-go", "lyft"},
+}
+
+func TestCountExit(t *testing.T) {
+	testcases := []struct {
+		path   string
+		expect int
+	}{
+		{"testdata/example.go", changedExitCode},
+		{"testdata/first1.out", 0},
+		{"testdata/does-not-exist.go", 1},
 	}
 	for _, tt := range testcases {
-		t.Run(tt.importPath, func(t *testing.T) {
-			got := guessPackageName(tt.importPath)
-			if tt.expect != got {
-				t.Errorf("expected: %s, got: %s", tt.expect, got)
+		t.Run(tt.path, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+			*countExit = true
+			handleFile(token.NewFileSet(), false, tt.path, ioutil.Discard)
+			if got := exitStatus(); got != tt.expect {
+				t.Errorf("expected: %d, got: %d", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestScopesJSON(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	src := `package pkg
+
+var a int
+
+func f(b int) {
+	c := 1
+	{
+		var d int
+	}
+	_ = func(e int) {}
+}
+`
+	var buf bytes.Buffer
+	if err := writeScopes(&buf, token.NewFileSet(), []byte(src), "scopes.go"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Filename string
+		Scope    dedup.ScopeJSON
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// Check the kinds and idents of the tree, ignoring positions.
+	var describe func(s dedup.ScopeJSON) string
+	describe = func(s dedup.ScopeJSON) string {
+		d := fmt.Sprintf("%s%v", s.Kind, s.Idents)
+		for _, in := range s.Inner {
+			d += "(" + describe(in) + ")"
+		}
+		return d
+	}
+	want := "file[a f](func[b](block[c](block[d])(funclit[e](block[]))))"
+	if got.Filename != "scopes.go" {
+		t.Errorf("expected filename: scopes.go, got: %s", got.Filename)
+	}
+	if d := describe(got.Scope); d != want {
+		t.Errorf("expected: %s, got: %s", want, d)
+	}
+	if got.Scope.Start != "scopes.go:1:1" || got.Scope.End != "scopes.go:11:2" {
+		t.Errorf("unexpected file scope range: %s-%s", got.Scope.Start, got.Scope.End)
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	filenames := []string{
+		"testdata/build-constraint.go",
+		"testdata/package-doc.go",
+		"testdata/package-doc2.go",
+		"testdata/name-collision-fix.go",
+		"testdata/simplify.go",
+		"testdata/redundant-alias.go",
+	}
+	for _, path := range filenames {
+		t.Run(path, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+			parseFlags(path)
+
+			src, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fset := token.NewFileSet()
+			first, err := processFile(fset, src, path)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			second, err := processFile(fset, first.Output, path)
+			if err != nil {
+				t.Fatalf("unexpected error on second run: %s", err)
+			}
+			if second.Changed {
+				t.Errorf("expected second run to make no changes, got:\n%s", second.Output)
+			}
+		})
+	}
+}
+
+func TestSince(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := ioutil.ReadFile("testdata/example.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, name := range []string{"old.go", "sub/new.go"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := now.Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "old.go"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	mode = modeList
+	if err := setSince(now.Add(-time.Hour).Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	handleDir(token.NewFileSet(), dir, &buf)
+
+	want := filepath.Join(dir, "sub", "new.go") + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("expected: %q, got: %q", want, got)
+	}
+}
+
+// With a git revision, -since handles the files changed since the revision
+// and untracked files, and fails for a bad revision.
+func TestSinceRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	resetFlags()
+	defer resetFlags()
+
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s\n%s", args[0], err, out)
+		}
+	}
+	write := func(name string) {
+		if err := ioutil.WriteFile(name, []byte("package pkg\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	write("committed.go")
+	write("changed.go")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	if err := ioutil.WriteFile("changed.go", []byte("package pkg // changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	write("untracked.go")
+
+	if err := setSince("HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"committed.go": false, "changed.go": true, "untracked.go": true} {
+		if got := sinceFiles[absPath(name)]; got != want {
+			t.Errorf("%s: expected handled: %t, got: %t", name, want, got)
+		}
+	}
+
+	sinceFiles = nil
+	if err := setSince("no-such-revision"); err == nil {
+		t.Error("expected error for bad revision")
+	}
+	if sinceFiles != nil {
+		t.Error("expected no files to be set for bad revision")
+	}
+}
+
+func TestResult(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	pos := func(filename string, line, column int) string {
+		return fmt.Sprintf("%s:%d:%d", filename, line, column)
+	}
+
+	t.Run("changed", func(t *testing.T) {
+		const path = "testdata/example.go"
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := processFile(token.NewFileSet(), src, path)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !result.Changed {
+			t.Errorf("expected Changed")
+		}
+		if len(result.RemovedSpecs) != 1 {
+			t.Fatalf("expected 1 removed spec, got %d", len(result.RemovedSpecs))
+		}
+		spec := result.RemovedSpecs[0]
+		if spec.Position.String() != pos(path, 5, 2) || spec.Name != "fe" || spec.Path != "code.org/frontend" ||
+			spec.KeptPosition.String() != pos(path, 4, 2) || spec.KeptName != "" {
+			t.Errorf("unexpected removed spec: %+v", spec)
+		}
+		if len(result.Rewrites) != 1 {
+			t.Fatalf("expected 1 rewrite, got %d", len(result.Rewrites))
+		}
+		rw := result.Rewrites[0]
+		if rw.Position.String() != pos(path, 10, 15) || rw.From != "fe" || rw.To != "frontend" {
+			t.Errorf("unexpected rewrite: %+v", rw)
+		}
+		if len(result.Conflicts) != 0 {
+			t.Errorf("expected no conflicts, got %+v", result.Conflicts)
+		}
+		out, err := ioutil.ReadFile(outPath(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		equalBytes(t, out, result.Output, bytes.TrimSpace)
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		const path = "testdata/cannot.go"
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := processFile(token.NewFileSet(), src, path)
+		if err == nil {
+			t.Fatalf("expected error")
+		}
+		if result.Changed || !bytes.Equal(result.Output, src) {
+			t.Errorf("expected file to be unchanged")
+		}
+		if len(result.RemovedSpecs) != 1 {
+			t.Errorf("expected 1 removed spec, got %d", len(result.RemovedSpecs))
+		}
+		if len(result.Conflicts) != 1 {
+			t.Fatalf("expected 1 conflict, got %d", len(result.Conflicts))
+		}
+		c := result.Conflicts[0]
+		if c.Position.String() != pos(path, 11, 9) || c.From != "u" || c.To != "url" || c.Message != err.Error() {
+			t.Errorf("unexpected conflict: %+v", c)
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		resetFlags()
+		defer resetFlags()
+		*onConflict = "partial"
+
+		path := "testdata/on-conflict-partial.go"
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := processFile(token.NewFileSet(), src, path)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !result.Changed || len(result.RemovedSpecs) != 1 || len(result.Rewrites) != 1 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+		if len(result.Conflicts) != 1 || result.Conflicts[0].From != "s" {
+			t.Errorf("unexpected conflicts: %+v", result.Conflicts)
+		}
+		if len(result.Warnings) != 1 {
+			t.Errorf("expected 1 warning, got %q", result.Warnings)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		src := []byte("package pkg\n\nimport \"fmt\"\n")
+		result, err := processFile(token.NewFileSet(), src, "clean.go")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result.Changed || len(result.RemovedSpecs) != 0 || !bytes.Equal(result.Output, src) {
+			t.Errorf("unexpected result: %+v", result)
+		}
+	})
+}
+
+func TestErrorsFile(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	f, err := ioutil.TempFile("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	errOut = f
+
+	var buf bytes.Buffer
+	handleFile(token.NewFileSet(), false, "testdata/cannot.go", &buf)
+	f.Close()
+
+	if buf.Len() != 0 {
+		t.Errorf("expected no output, got: %s", buf.Bytes())
+	}
+	got, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile("testdata/cannot.err")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalBytes(t, want, got, bytes.TrimSpace)
+	if exitCode != 1 {
+		t.Errorf("expected exit code 1, got %d", exitCode)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	*diagnose = true
+	setupReporters()
+
+	var buf bytes.Buffer
+	fset := token.NewFileSet()
+	handleFile(fset, false, "testdata/example.go", &buf)
+	handleFile(fset, false, "testdata/named.go", &buf)
+
+	want := `testdata/example.go:5:2: duplicate import of "code.org/frontend"; remove in favor of line 4
+testdata/named.go:5:8: duplicate import of "math"; remove in favor of line 7
+testdata/named.go:6:8: duplicate import of "math"; remove in favor of line 7
+`
+	if got := buf.String(); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := ioutil.ReadFile("testdata/example.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile("testdata/example.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clean := []byte("package pkg\n")
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"pkg/example.go", src},
+		{"pkg/clean.go", clean},
+		{"README", src},
+	}
+
+	for _, ext := range []string{".zip", ".tar.gz"} {
+		t.Run(ext, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+
+			inPath := filepath.Join(dir, "in"+ext)
+			outPath := filepath.Join(dir, "out"+ext)
+			format, err := archiveFormatOf(inPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var entries []*archiveEntry
+			for _, f := range files {
+				e := &archiveEntry{data: f.data}
+				if format == formatZip {
+					e.zipHeader = &zip.FileHeader{Name: f.name, Method: zip.Deflate}
+				} else {
+					e.tarHeader = &tar.Header{Name: f.name, Mode: 0644, Typeflag: tar.TypeReg}
+				}
+				entries = append(entries, e)
+			}
+			if err := writeArchive(inPath, format, entries); err != nil {
+				t.Fatal(err)
 			}
+
+			var buf bytes.Buffer
+			handleArchive(token.NewFileSet(), inPath, outPath, &buf)
+			if exitCode != 0 {
+				t.Fatalf("unexpected exit code %d", exitCode)
+			}
+			if got := buf.String(); got != "pkg/example.go\n" {
+				t.Errorf("unexpected report: %q", got)
+			}
+
+			got, err := readArchive(outPath, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(files) {
+				t.Fatalf("expected %d entries, got %d", len(files), len(got))
+			}
+			equalBytes(t, want, got[0].data, bytes.TrimSpace)
+			equalBytes(t, clean, got[1].data, nil)
+			equalBytes(t, src, got[2].data, nil)
 		})
 	}
 }
+
+func TestDeeplyNested(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	nested := func(depth int) []byte {
+		var buf bytes.Buffer
+		buf.WriteString("package pkg\n\nimport (\n\t\"strings\"\n\ts \"strings\"\n)\n\nfunc f() {\n")
+		buf.WriteString(strings.Repeat("{\n", depth))
+		buf.WriteString("_ = s.Title\n")
+		buf.WriteString(strings.Repeat("}\n", depth))
+		buf.WriteString("}\n")
+		return buf.Bytes()
+	}
+
+	// Just under the parser's limit.
+	result, err := processFile(token.NewFileSet(), nested(990), "nested.go")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(result.Rewrites) != 1 {
+		t.Errorf("expected 1 rewrite, got %d", len(result.Rewrites))
+	}
+
+	// Beyond the limit, the parser reports an error.
+	_, err = processFile(token.NewFileSet(), nested(5000), "nested.go")
+	if err == nil {
+		t.Errorf("expected parse error")
+	}
+}
+
+func TestKeepDocReferencedWarning(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	const path = "testdata/keep-doc-referenced.go"
+	parseFlags(path)
+
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := processFile(token.NewFileSet(), src, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{
+		`testdata/keep-doc-referenced.go:7:2: keeping duplicate import s "strings": referenced in comment at testdata/keep-doc-referenced.go:12:1`,
+	}
+	if !reflect.DeepEqual(want, result.Warnings) {
+		t.Errorf("expected: %q, got: %q", want, result.Warnings)
+	}
+}
+
+func TestAffectedPackages(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dup, err := ioutil.ReadFile("testdata/example.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clean := []byte("package pkg\n")
+	files := map[string][]byte{
+		"a/x.go":   dup,
+		"a/y.go":   dup,
+		"b/x.go":   clean,
+		"c/d/x.go": clean,
+		"c/d/y.go": dup,
+		"e.go":     dup,
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mode = modeWrite
+	handleDir(token.NewFileSet(), dir, ioutil.Discard)
+	var buf bytes.Buffer
+	writeAffectedPackages(&buf)
+
+	want := strings.Join([]string{
+		dir,
+		filepath.Join(dir, "a"),
+		filepath.Join(dir, "c", "d"),
+	}, "\n") + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("expected: %q, got: %q", want, got)
+	}
+}
+
+// The usage of -keep lists every registered strategy.
+func TestKeepUsage(t *testing.T) {
+	usage := flagSet.Lookup("keep").Usage
+	for _, name := range dedup.StrategyNames() {
+		if !strings.Contains(usage, name) {
+			t.Errorf("expected -keep usage to mention %s, got: %s", name, usage)
+		}
+	}
+}
+
+func TestResolveMode(t *testing.T) {
+	testcases := []struct {
+		flags  []*bool
+		expect outputMode
+		err    bool
+	}{
+		{nil, modeStdout, false},
+		{[]*bool{list}, modeList, false},
+		{[]*bool{diff}, modeDiff, false},
+		{[]*bool{overwrite}, modeWrite, false},
+		{[]*bool{dryRun}, modeDryRun, false},
+		{[]*bool{overwrite, diff}, modeWriteDiff, false},
+		{[]*bool{check}, modeCheck, false},
+		{[]*bool{check, overwrite}, 0, true},
+		{[]*bool{count}, modeCount, false},
+		{[]*bool{list, diff}, 0, true},
+		{[]*bool{overwrite, dryRun}, 0, true},
+		{[]*bool{list, overwrite}, modeWrite, false},
+		{[]*bool{list, diff, overwrite}, modeWriteDiff, false},
+		{[]*bool{list, check}, 0, true},
+	}
+	for i, tt := range testcases {
+		resetFlags()
+		for _, f := range tt.flags {
+			*f = true
+		}
+		got, err := resolveMode()
+		if (err != nil) != tt.err {
+			t.Errorf("%d: unexpected error: %v", i, err)
+		} else if got != tt.expect {
+			t.Errorf("%d: expected mode: %d, got: %d", i, tt.expect, got)
+		}
+	}
+	resetFlags()
+}
+
+// As with gofmt, -l -w writes the files and lists those written.
+func TestListWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"example.go", "group-single.go"} {
+		src, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resetFlags()
+	defer resetFlags()
+	*list = true
+	*overwrite = true
+	m, err := resolveMode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mode = m
+	var buf bytes.Buffer
+	handleDir(token.NewFileSet(), dir, &buf)
+
+	path := filepath.Join(dir, "example.go")
+	if want := path + "\n"; buf.String() != want {
+		t.Errorf("expected output %q, got %q", want, buf.String())
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect, err := ioutil.ReadFile("testdata/example.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalBytes(t, expect, got, bytes.TrimSpace)
+}
+
+func TestWriteOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := ioutil.ReadFile("testdata/example.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := ioutil.ReadFile("testdata/example.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		mode    outputMode
+		output  string // substring of the output; empty for no output
+		written bool
+	}{
+		{modeStdout, string(res), false},
+		{modeList, "example.go\n", false},
+		{modeDiff, "+func send(req frontend.Request) {}", false},
+		{modeWrite, "", true},
+		{modeWriteDiff, "+func send(req frontend.Request) {}", true},
+		{modeDryRun, "", false},
+	}
+	for _, tt := range testcases {
+		resetFlags()
+		mode = tt.mode
+		path := filepath.Join(dir, "example.go")
+		if err := ioutil.WriteFile(path, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := writeOutput(&buf, false, src, res, path); err != nil {
+			t.Errorf("mode %d: unexpected error: %s", tt.mode, err)
+			continue
+		}
+		if tt.output == "" && buf.Len() != 0 {
+			t.Errorf("mode %d: expected no output, got: %s", tt.mode, buf.Bytes())
+		}
+		if !strings.Contains(buf.String(), tt.output) {
+			t.Errorf("mode %d: expected output to contain %q, got: %s", tt.mode, tt.output, buf.Bytes())
+		}
+		got, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if written := bytes.Equal(got, res); written != tt.written {
+			t.Errorf("mode %d: expected written: %t, got: %t", tt.mode, tt.written, written)
+		}
+	}
+	resetFlags()
+}
+
+func TestStdinFilename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the file on disk differs from the stdin content, like an editor buffer
+	// with unsaved changes.
+	path := filepath.Join(dir, "example.go")
+	if err := ioutil.WriteFile(path, []byte("package pkg\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkWritable(path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := checkWritable(filepath.Join(dir, "does-not-exist.go")); err == nil {
+		t.Errorf("expected error for nonexistent file")
+	}
+	if err := checkWritable(dir); err == nil {
+		t.Errorf("expected error for directory")
+	}
+
+	stdin, err := os.Open("testdata/example.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = oldStdin }()
+
+	resetFlags()
+	*stdinName = path
+	mode = modeWrite
+	var buf bytes.Buffer
+	handleFile(token.NewFileSet(), true, path, &buf)
+	resetFlags()
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect, err := ioutil.ReadFile("testdata/example.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalBytes(t, expect, got, bytes.TrimSpace)
+	if buf.Len() != 0 {
+		t.Errorf("expected no output, got: %s", buf.Bytes())
+	}
+}
+
+// With -w and -stdin-filename, the stdin content replaces the file's content
+// on disk, which is what is compared with the result and restored by
+// -build-check.
+func TestStdinFilenameOriginal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "example.go")
+	onDisk := []byte("package pkg\n")
+	if err := ioutil.WriteFile(path, onDisk, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldStdin := os.Stdin
+	defer func() { os.Stdin = oldStdin }()
+	run := func(buffer string) {
+		f, err := ioutil.TempFile(dir, "stdin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(buffer); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Seek(0, 0); err != nil {
+			t.Fatal(err)
+		}
+		os.Stdin = f
+		handleFile(token.NewFileSet(), true, path, ioutil.Discard)
+	}
+
+	resetFlags()
+	defer resetFlags()
+	*stdinName = path
+	*buildCheck = true
+	mode = modeWrite
+
+	// A buffer without duplicate imports that differs from the file.
+	buffer := "package pkg\n\nvar x = 1\n"
+	run(buffer)
+	if got, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if string(got) != buffer {
+		t.Errorf("expected file to be written, got:\n%s", got)
+	}
+	if !anyChanged {
+		t.Error("expected file to be changed")
+	}
+	if got := writtenFiles[dir][path].src; !bytes.Equal(got, onDisk) {
+		t.Errorf("expected original content on disk to be recorded, got:\n%s", got)
+	}
+
+	// A buffer the same as the file.
+	resetFlags()
+	*stdinName = path
+	mode = modeWrite
+	run(buffer)
+	if anyChanged {
+		t.Error("expected file to be unchanged")
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	resetFlags()
+	*junitFile = "report.xml" // not written; only enables recording
+	setupReporters()
+	mode = modeDryRun
+	errOut = ioutil.Discard
+	fset := token.NewFileSet()
+	for _, path := range []string{
+		"testdata/example.go",
+		"testdata/group-single.go",
+		"testdata/strict-unnamed.go",
+	} {
+		parseFlags(path)
+		handleFile(fset, false, path, ioutil.Discard)
+	}
+	var buf bytes.Buffer
+	if err := junitFileReporter.Flush(&buf); err != nil {
+		t.Fatal(err)
+	}
+	resetFlags()
+
+	var got junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid XML: %s\n%s", err, buf.Bytes())
+	}
+	if len(got.Suites) != 1 {
+		t.Fatalf("expected 1 test suite, got %d", len(got.Suites))
+	}
+	suite := got.Suites[0]
+	if suite.Tests != 3 || suite.Failures != 1 || suite.Errors != 1 {
+		t.Errorf("expected tests=3 failures=1 errors=1, got tests=%d failures=%d errors=%d",
+			suite.Tests, suite.Failures, suite.Errors)
+	}
+	if len(suite.Cases) != 3 {
+		t.Fatalf("expected 3 test cases, got %d", len(suite.Cases))
+	}
+	if c := suite.Cases[0]; c.Name != "testdata/example.go" || c.Failure == nil || c.Error != nil ||
+		!strings.Contains(c.Failure.Text, `testdata/example.go:5:2: duplicate import of "code.org/frontend"`) {
+		t.Errorf("expected failure for example.go, got %+v", c)
+	}
+	if c := suite.Cases[1]; c.Name != "testdata/group-single.go" || c.Failure != nil || c.Error != nil {
+		t.Errorf("expected pass for group-single.go, got %+v", c)
+	}
+	if c := suite.Cases[2]; c.Name != "testdata/strict-unnamed.go" || c.Error == nil || c.Failure != nil {
+		t.Errorf("expected error for strict-unnamed.go, got %+v", c)
+	}
+}
+
+// BenchmarkProcessFile processes a set of files similar to a typical tree,
+// where most files have at most one import and few have duplicates.
+func BenchmarkProcessFile(b *testing.B) {
+	resetFlags()
+	var srcs [][]byte
+	for i := 0; i < 100; i++ {
+		var src string
+		switch {
+		case i%10 == 0:
+			src = "package pkg\n\nimport (\n\t\"fmt\"\n\tf \"fmt\"\n)\n\nvar _ = f.Println\nvar _ = fmt.Println\n"
+		case i%3 == 0:
+			src = "package pkg\n\nfunc F(x int) int { return x * 2 }\n"
+		default:
+			src = "package pkg\n\nimport \"fmt\"\n\nfunc F() { fmt.Println(\"hello\") }\n"
+		}
+		srcs = append(srcs, []byte(src))
+	}
+	fset := token.NewFileSet()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, src := range srcs {
+			if _, err := processFile(fset, src, fmt.Sprintf("file%d.go", j)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestLSPEdits(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	src := `package pkg
+
+import (
+	"strings"
+	// doc
+	s "strings" // comment
+)
+
+import str "strings"
+
+var _ = "😀é"; var _ = s.Title
+var _ = str.ToLower
+`
+	result, err := processFile(token.NewFileSet(), []byte(src), "edits.go")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pos := func(line, char int) dedup.LSPPosition { return dedup.LSPPosition{Line: line, Character: char} }
+	want := []dedup.TextEdit{
+		{Range: dedup.Range{Start: pos(4, 0), End: pos(6, 0)}, NewText: ""},            // s "strings", with its comments
+		{Range: dedup.Range{Start: pos(8, 0), End: pos(9, 0)}, NewText: ""},            // import str "strings"
+		{Range: dedup.Range{Start: pos(10, 23), End: pos(10, 24)}, NewText: "strings"}, // "😀" is 2 UTF-16 code units
+
+		{Range: dedup.Range{Start: pos(11, 8), End: pos(11, 11)}, NewText: "strings"},
+	}
+	if !reflect.DeepEqual(result.Edits, want) {
+		t.Errorf("expected edits:\n%+v\ngot:\n%+v", want, result.Edits)
+	}
+
+	var buf bytes.Buffer
+	if err := writeEdits(&buf, "edits.go", result); err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"filename":"edits.go","edits":[{"range":{"start":{"line":4,"character":0},"end":{"line":6,"character":0}},"newText":""},`
+	if !strings.HasPrefix(buf.String(), expect) {
+		t.Errorf("expected JSON prefix %s, got: %s", expect, buf.Bytes())
+	}
+}
+
+func TestDistinctAliases(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	path := "testdata/distinct-aliases.go"
+	parseFlags(path)
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := processFile(token.NewFileSet(), src, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(result.RemovedSpecs) != 2 {
+		t.Errorf("expected 2 removed specs, got %d", len(result.RemovedSpecs))
+	}
+	if len(result.Rewrites) != 0 {
+		t.Errorf("expected no rewrites, got %+v", result.Rewrites)
+	}
+	want := []string{
+		`testdata/distinct-aliases.go:8:2: keeping import of "fmt": name differs from import on line 6`,
+		`testdata/distinct-aliases.go:10:2: keeping import of "fmt": name differs from import on line 6`,
+	}
+	if !reflect.DeepEqual(result.Warnings, want) {
+		t.Errorf("expected warnings:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(result.Warnings, "\n"))
+	}
+}
+
+func TestShowGuesses(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	if err := pkgNames.Set("example.com/mapped=mp"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { pkgNames.m = nil }()
+
+	path := "testdata/show-guesses.go"
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeGuesses(&buf, token.NewFileSet(), src, path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := `testdata/show-guesses.go:4:2: "example.com/mapped" -> mp (mapping)
+testdata/show-guesses.go:5:2: "example.com/go-yaml.v2" -> yaml (guessed)
+testdata/show-guesses.go:6:2: "example.com/go-yaml.v2" -> y (explicit)
+testdata/show-guesses.go:7:2: "strings" -> strings (resolved)
+`
+	equalBytes(t, []byte(want), buf.Bytes(), nil)
+}
+
+// Output for the files in a directory is in lexical path order, so that it is
+// reproducible across runs.
+func TestStableOutput(t *testing.T) {
+	run := func() []byte {
+		resetFlags()
+		defer resetFlags()
+		mode = modeDiff
+		errOut = ioutil.Discard
+		var buf bytes.Buffer
+		handleDir(token.NewFileSet(), "testdata", &buf)
+		return buf.Bytes()
+	}
+	first, second := run(), run()
+	if len(first) == 0 {
+		t.Fatal("expected output")
+	}
+	equalBytes(t, first, second, nil)
+
+	var names []string
+	for _, line := range strings.Split(string(first), "\n") {
+		if strings.HasPrefix(line, "diff -u ") {
+			names = append(names, strings.Fields(line)[3])
+		}
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("expected files in sorted order, got: %v", names)
+	}
+}
+
+// The output is the same regardless of -p.
+func TestParallel(t *testing.T) {
+	run := func(n int) (out, errs []byte) {
+		resetFlags()
+		defer resetFlags()
+		*parallel = n
+		mode = modeDiff
+		var errBuf bytes.Buffer
+		errOut = &errBuf
+		var buf bytes.Buffer
+		handleDir(token.NewFileSet(), "testdata", &buf)
+		if prefetched != nil {
+			t.Error("expected prefetcher to be done")
+		}
+		return buf.Bytes(), errBuf.Bytes()
+	}
+	out1, errs1 := run(1)
+	out8, errs8 := run(8)
+	if len(out1) == 0 || len(errs1) == 0 {
+		t.Fatal("expected output and errors")
+	}
+	equalBytes(t, out1, out8, nil)
+	equalBytes(t, errs1, errs8, nil)
+}
+
+// Files skipped before being read are never prefetched, and the output is the
+// same as without -p.
+func TestParallelSkipped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := ioutil.ReadFile("testdata/example.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	large := append(append([]byte{}, src...), "// padding\n"...)
+	for name, b := range map[string][]byte{"a.go": src, "b.go": large, "c.go": src} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(n int) []byte {
+		resetFlags()
+		defer resetFlags()
+		*parallel = n
+		*maxSize = int64(len(src))
+		mode = modeDiff
+		var buf bytes.Buffer
+		handleDir(token.NewFileSet(), dir, &buf)
+		return buf.Bytes()
+	}
+	out1, out4 := run(1), run(4)
+	if bytes.Contains(out1, []byte("b.go")) {
+		t.Errorf("expected b.go to be skipped, got: %s", out1)
+	}
+	equalBytes(t, out1, out4, nil)
+
+	resetFlags()
+	defer resetFlags()
+	p := startPrefetch(token.NewFileSet(), []string{filepath.Join(dir, "a.go")}, 2)
+	if pf := p.lookup(large, filepath.Join(dir, "b.go")); pf != nil {
+		t.Error("expected no result for file that wasn't prefetched")
+	}
+	p.release(filepath.Join(dir, "b.go"))
+	p.release(filepath.Join(dir, "a.go"))
+}
+
+func TestSkipSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := ioutil.ReadFile("testdata/example.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "target.go")
+	if err := ioutil.WriteFile(target, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tree := filepath.Join(dir, "tree")
+	if err := os.Mkdir(tree, 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(tree, "link.go")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("cannot create symlink: %s", err)
+	}
+
+	for _, skip := range []bool{true, false} {
+		resetFlags()
+		*skipSymlinks = skip
+		mode = modeWrite
+		handleDir(token.NewFileSet(), tree, ioutil.Discard)
+		resetFlags()
+
+		got, err := ioutil.ReadFile(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if written := !bytes.Equal(got, src); written == skip {
+			t.Errorf("skip-symlinks=%t: expected written: %t, got: %t", skip, !skip, written)
+		}
+	}
+}
+
+func TestDiffStrategy(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	src := []byte(`package pkg
+
+import (
+	"fmt"
+	f "fmt"
+	"strings"
+	"strings"
+	"os"
+	o "os"
+)
+`)
+	testcases := []struct {
+		strategy string
+		want     string
+	}{
+		{"unnamed", ""},
+		{"first", ""},
+		{"named", `diff.go:5:2: strategy named keeps this import of "fmt"; strategy unnamed keeps the one on line 4
+diff.go:9:2: strategy named keeps this import of "os"; strategy unnamed keeps the one on line 8
+`},
+	}
+	for _, tt := range testcases {
+		*strategy = tt.strategy
+		var buf bytes.Buffer
+		if err := writeStrategyDiff(&buf, token.NewFileSet(), src, "diff.go"); err != nil {
+			t.Fatalf("%s: unexpected error: %s", tt.strategy, err)
+		}
+		equalBytes(t, []byte(tt.want), buf.Bytes(), nil)
+		if *strategy != tt.strategy {
+			t.Errorf("expected strategy to be restored to %s, got %s", tt.strategy, *strategy)
+		}
+	}
+}
+
+func TestOutDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := ioutil.ReadFile("testdata/example.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(outPath("testdata/example.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clean := []byte("package pkg\n\nimport \"fmt\"\n")
+
+	tree := filepath.Join(dir, "tree")
+	if err := os.MkdirAll(filepath.Join(tree, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tree, "sub", "example.go"), src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tree, "clean.go"), clean, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, copyAll := range []bool{false, true} {
+		resetFlags()
+		out := filepath.Join(dir, fmt.Sprintf("out-%t", copyAll))
+		*outDir = out
+		*copyUnchanged = copyAll
+		mode = modeOutDir
+		handleDir(token.NewFileSet(), tree, ioutil.Discard)
+		resetFlags()
+
+		got, err := ioutil.ReadFile(filepath.Join(out, "sub", "example.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		equalBytes(t, want, got, bytes.TrimSpace)
+
+		got, err = ioutil.ReadFile(filepath.Join(out, "clean.go"))
+		if copyAll {
+			if err != nil {
+				t.Fatal(err)
+			}
+			equalBytes(t, clean, got, nil)
+		} else if !os.IsNotExist(err) {
+			t.Errorf("expected unchanged file not to be written, got err: %v", err)
+		}
+
+		// The originals are untouched.
+		got, err = ioutil.ReadFile(filepath.Join(tree, "sub", "example.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		equalBytes(t, src, got, nil)
+	}
+}
+
+func TestMappingWarnings(t *testing.T) {
+	defer func() { pkgNames.m = nil }()
+	for _, m := range []string{
+		"github.com/proj/serverimpl=server",
+		"github.com/priarie/go-k8s-client=clientk8s",
+		"code.org/frontend=fe",
+		"gopkg.in/yaml.v2=yaml",
+		"github.com/sirupsen/logrus=yaml",
+		"example.com/bar=xyz",
+	} {
+		if err := pkgNames.Set(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"-m example.com/bar=xyz: package name differs from bar, the name guessed from the path",
+		"-m github.com/sirupsen/logrus=yaml: package name differs from logrus, the name guessed from the path",
+	}
+	if got := mappingWarnings(); !reflect.DeepEqual(want, got) {
+		t.Errorf("expected: %q, got: %q", want, got)
+	}
+}
+
+func TestJSONReport(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	stdin, err := os.Open("testdata/example.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = oldStdin }()
+
+	*jsonReport = true
+	setupReporters()
+	fset := token.NewFileSet()
+	var buf bytes.Buffer
+	handleFile(fset, true, "<standard input>", &buf)
+	handleFile(fset, false, "testdata/named.go", &buf)
+	if buf.Len() != 0 {
+		t.Errorf("expected no output, got: %s", buf.Bytes())
+	}
+	if err := reporter.Flush(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []fileReport
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(got))
+	}
+	if got[0].Filename != "<standard input>" || !got[0].Changed || len(got[0].Removed) != 1 {
+		t.Errorf("unexpected stdin entry: %+v", got[0])
+	}
+	want := removedImport{Path: "code.org/frontend", Name: "fe", Line: 5, Column: 2, KeptLine: 4, KeptColumn: 2, Strategy: "unnamed"}
+	if len(got[0].Removed) == 1 && got[0].Removed[0] != want {
+		t.Errorf("expected: %+v, got: %+v", want, got[0].Removed[0])
+	}
+	if got[1].Filename != "testdata/named.go" || !got[1].Changed || len(got[1].Removed) != 2 {
+		t.Errorf("unexpected file entry: %+v", got[1])
+	}
+
+	// The strategy is reported as what actually chose the kept import.
+	resetFlags()
+	*jsonReport = true
+	*pinMarker = "keep"
+	setupReporters()
+	buf.Reset()
+	src := "package pkg\n\nimport (\n\t\"strings\"\n\ts \"strings\" // keep\n)\n\nvar _ = strings.ToLower\n"
+	result, err := processFile(fset, []byte(src), "pin.go")
+	reporter.Record(&buf, newFileReport("pin.go", result, err))
+	if err := reporter.Flush(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+	if len(got) != 1 || len(got[0].Removed) != 1 || got[0].Removed[0].Strategy != "pin" {
+		t.Errorf("expected removed import decided by pin, got: %+v", got)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := ioutil.ReadFile("testdata/example.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []string{"a.go", "b/b.go", "b/c/c.go", "b/c/d/d.go"}
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, depth := range []int{-1, 0, 1, 2, 3} {
+		resetFlags()
+		*maxDepth = depth
+		mode = modeList
+		var buf bytes.Buffer
+		handleDir(token.NewFileSet(), dir, &buf)
+		resetFlags()
+
+		var want bytes.Buffer
+		for i, f := range files {
+			if depth == -1 || i <= depth {
+				fmt.Fprintln(&want, filepath.Join(dir, filepath.FromSlash(f)))
+			}
+		}
+		if buf.String() != want.String() {
+			t.Errorf("depth %d: expected:\n%s\ngot:\n%s", depth, want.String(), buf.String())
+		}
+	}
+}
+
+func TestReportFormats(t *testing.T) {
+	for _, format := range []string{"text", "json", "junit", "sarif"} {
+		t.Run(format, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+			*reportFmt = format
+			*diagnose = format == "text"
+			setupReporters()
+
+			var buf bytes.Buffer
+			handleFile(token.NewFileSet(), false, "testdata/named.go", &buf)
+			if format != "text" && buf.Len() != 0 {
+				t.Errorf("expected no output before flush, got: %s", buf.Bytes())
+			}
+			if err := reporter.Flush(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			switch format {
+			case "text":
+				want := `testdata/named.go:5:8: duplicate import of "math"; remove in favor of line 7
+testdata/named.go:6:8: duplicate import of "math"; remove in favor of line 7
+`
+				if got := buf.String(); got != want {
+					t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+				}
+			case "json":
+				var got []fileReport
+				if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+					t.Fatalf("invalid JSON: %s", err)
+				}
+				if len(got) != 1 || len(got[0].Removed) != 2 || got[0].Removed[0].Line != 5 || got[0].Removed[0].KeptLine != 7 {
+					t.Errorf("unexpected report: %+v", got)
+				}
+			case "junit":
+				var got junitTestSuites
+				if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+					t.Fatalf("invalid XML: %s", err)
+				}
+				if len(got.Suites) != 1 || got.Suites[0].Tests != 1 || got.Suites[0].Failures != 1 {
+					t.Errorf("unexpected report: %+v", got)
+				}
+			case "sarif":
+				var got sarifLog
+				if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+					t.Fatalf("invalid JSON: %s", err)
+				}
+				if got.Version != "2.1.0" || len(got.Runs) != 1 || len(got.Runs[0].Results) != 2 {
+					t.Fatalf("unexpected report: %+v", got)
+				}
+				loc := got.Runs[0].Results[0].Locations[0].PhysicalLocation
+				if loc.ArtifactLocation.URI != "testdata/named.go" || loc.Region.StartLine != 5 || loc.Region.StartColumn != 8 {
+					t.Errorf("unexpected location: %+v", loc)
+				}
+			}
+		})
+	}
+}
+
+func TestSARIF(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	*reportFmt = "sarif"
+	setupReporters()
+
+	abs, err := filepath.Abs("testdata/named.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	var buf bytes.Buffer
+	handleFile(fset, false, "testdata/example.go", &buf)
+	handleFile(fset, false, abs, &buf)
+	if err := reporter.Flush(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var got sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+	if got.Version != "2.1.0" || !strings.Contains(got.Schema, "sarif-2.1.0") || len(got.Runs) != 1 {
+		t.Fatalf("unexpected log: %+v", got)
+	}
+	run := got.Runs[0]
+	if rules := run.Tool.Driver.Rules; len(rules) != 1 || rules[0].ID != "duplicate-import" {
+		t.Errorf("unexpected rules: %+v", rules)
+	}
+	if len(run.Results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(run.Results))
+	}
+
+	r := run.Results[0]
+	if r.RuleID != "duplicate-import" || r.RuleIndex != 0 || r.Level != "warning" {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	want := sarifPhysicalLocation{sarifArtifactLocation{"testdata/example.go", "%SRCROOT%"}, sarifRegion{5, 2}}
+	if len(r.Locations) != 1 || r.Locations[0].PhysicalLocation != want {
+		t.Errorf("expected location %+v, got %+v", want, r.Locations)
+	}
+	want.Region = sarifRegion{4, 2}
+	if len(r.RelatedLocations) != 1 || r.RelatedLocations[0].PhysicalLocation != want ||
+		r.RelatedLocations[0].ID == nil || *r.RelatedLocations[0].ID != 1 {
+		t.Errorf("expected related location %+v, got %+v", want, r.RelatedLocations)
+	}
+
+	loc := run.Results[1].Locations[0].PhysicalLocation.ArtifactLocation
+	if !strings.HasPrefix(loc.URI, "file:///") || !strings.HasSuffix(loc.URI, "/testdata/named.go") || loc.URIBaseID != "" {
+		t.Errorf("expected file URI for absolute path, got %+v", loc)
+	}
+}
+
+func TestQuietUnchanged(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	src, err := ioutil.ReadFile("testdata/group-single.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+
+	// By default, an unchanged file is printed as is.
+	var buf bytes.Buffer
+	handleFile(fset, false, "testdata/group-single.go", &buf)
+	if !bytes.Equal(buf.Bytes(), src) {
+		t.Errorf("expected unchanged source, got:\n%s", buf.Bytes())
+	}
+	if exitStatus() != 0 {
+		t.Errorf("expected exit status 0, got %d", exitStatus())
+	}
+
+	resetFlags()
+	*quietUnchanged = true
+	buf.Reset()
+	handleFile(fset, false, "testdata/group-single.go", &buf)
+	if buf.Len() != 0 {
+		t.Errorf("expected no output, got:\n%s", buf.Bytes())
+	}
+	if exitStatus() != 0 {
+		t.Errorf("expected exit status 0, got %d", exitStatus())
+	}
+
+	// Changed files are still printed.
+	buf.Reset()
+	handleFile(fset, false, "testdata/example.go", &buf)
+	want, err := ioutil.ReadFile("testdata/example.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalBytes(t, want, buf.Bytes(), bytes.TrimSpace)
+}
+
+func TestCheck(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	*check = true
+	mode = modeCheck
+	fset := token.NewFileSet()
+
+	var buf bytes.Buffer
+	handleFile(fset, false, "testdata/group-single.go", &buf)
+	if buf.Len() != 0 {
+		t.Errorf("expected no output, got:\n%s", buf.Bytes())
+	}
+	if exitStatus() != 0 {
+		t.Errorf("expected exit status 0, got %d", exitStatus())
+	}
+
+	src, err := ioutil.ReadFile("testdata/example.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handleFile(fset, false, "testdata/example.go", &buf)
+	handleFile(fset, false, "testdata/named.go", &buf)
+	want := `testdata/example.go:5: duplicate imports of "code.org/frontend"
+testdata/named.go:5: duplicate imports of "math"
+`
+	if buf.String() != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+	if exitStatus() != 1 {
+		t.Errorf("expected exit status 1, got %d", exitStatus())
+	}
+	if got, err := ioutil.ReadFile("testdata/example.go"); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, src) {
+		t.Error("expected file to be unchanged")
+	}
+}
+
+// -check reports a file if and only if -l lists it, with the options that
+// affect which imports are removed.
+func TestCheckAgreesWithList(t *testing.T) {
+	for _, path := range []string{
+		"testdata/example.go",
+		"testdata/region.go",
+		"testdata/imports-only-parse.go",
+		"testdata/keep-doc-referenced.go",
+		"testdata/on-conflict-partial.go",
+		"testdata/on-conflict-skip.go",
+		"testdata/least-churn.go",
+	} {
+		run := func(m outputMode) (out, errs string) {
+			resetFlags()
+			defer resetFlags()
+			parseFlags(path)
+			mode = m
+			var outBuf, errBuf bytes.Buffer
+			errOut = &errBuf
+			handleFile(token.NewFileSet(), false, path, &outBuf)
+			return outBuf.String(), errBuf.String()
+		}
+		checkOut, checkErrs := run(modeCheck)
+		listOut, listErrs := run(modeList)
+		if reported, listed := checkOut != "", listOut != ""; reported != listed {
+			t.Errorf("%s: -check reported: %t, -l listed: %t", path, reported, listed)
+		}
+		if checkErrs != listErrs {
+			t.Errorf("%s: -check errors:\n%s\n-l errors:\n%s", path, checkErrs, listErrs)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	*count = true
+	*countExit = true
+	mode = modeCount
+	fset := token.NewFileSet()
+
+	var buf bytes.Buffer
+	for _, f := range []string{"testdata/group-single.go", "testdata/example.go", "testdata/named.go", "testdata/three-way-named.go"} {
+		handleFile(fset, false, f, &buf)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no per-file output, got:\n%s", buf.Bytes())
+	}
+	// 1 in example.go, 2 in named.go, and 2 in three-way-named.go.
+	if duplicateCount != 5 {
+		t.Errorf("expected count 5, got %d", duplicateCount)
+	}
+	if exitStatus() != changedExitCode {
+		t.Errorf("expected exit status %d, got %d", changedExitCode, exitStatus())
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	mode = modeList
+	fset := token.NewFileSet()
+
+	var buf bytes.Buffer
+	handleFile(fset, false, "testdata/generated.go", &buf)
+	if buf.Len() != 0 {
+		t.Errorf("expected generated file to be skipped, got:\n%s", buf.Bytes())
+	}
+
+	*generated = true
+	visited = make(map[string]bool)
+	handleFile(fset, false, "testdata/generated.go", &buf)
+	if got := buf.String(); got != "testdata/generated.go\n" {
+		t.Errorf("expected generated file to be listed with -generated, got:\n%s", got)
+	}
+
+	for _, tt := range []struct {
+		src  string
+		want bool
+	}{
+		{"// Code generated by stringer; DO NOT EDIT.\n\npackage p\n", true},
+		{"package p\n\n// Code generated by hand. DO NOT EDIT.\n", true},
+		{"// Code generated by stringer; DO NOT EDIT\npackage p\n", false},
+		{"/* Code generated by stringer; DO NOT EDIT. */\npackage p\n", false},
+		{"package p\n", false},
+	} {
+		if got := isGenerated([]byte(tt.src)); got != tt.want {
+			t.Errorf("isGenerated(%q): expected %t, got %t", tt.src, tt.want, got)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	*resolveNames = true
+
+	// fmt can be listed; the other package can't, so its name falls back
+	// to the guess, "yaml".
+	src := `package pkg
+
+import (
+	"fmt"
+	f "fmt"
+	"gopkg.in/nonexistent/go-yaml.v2"
+	y "gopkg.in/nonexistent/go-yaml.v2"
+)
+
+var _ = f.Println
+var _ = y.Marshal
+`
+	result, err := processFile(token.NewFileSet(), []byte(src), "resolve.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(result.Output, []byte("fmt.Println")) || !bytes.Contains(result.Output, []byte("yaml.Marshal")) {
+		t.Errorf("unexpected output:\n%s", result.Output)
+	}
+
+	if name, ok := resolver.resolve("fmt", "."); !ok || name != "fmt" {
+		t.Errorf("expected fmt, got %q (%t)", name, ok)
+	}
+	if _, ok := resolver.resolve("gopkg.in/nonexistent/go-yaml.v2", "."); ok {
+		t.Error("expected package that can't be listed to not resolve")
+	}
+	if _, ok := resolver.names[goListKey{".", "fmt"}]; !ok {
+		t.Error("expected result for fmt to be cached")
+	}
+}
+
+func TestBuildCheck(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	resetFlags()
+	defer resetFlags()
+	*overwrite = true
+	*buildCheck = true
+	mode = modeWrite
+
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The wrong mapping makes the rewrite of s.ToUpper break the build.
+	if err := pkgNames.Set("strings=wrong"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { pkgNames.m = nil }()
+
+	src := []byte(`package pkg
+
+import (
+	"strings"
+	s "strings"
+)
+
+var _ = strings.ToLower("a")
+var _ = s.ToUpper("b")
+`)
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/pkg\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "pkg.go")
+	if err := ioutil.WriteFile(filename, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	handleFile(token.NewFileSet(), false, filename, ioutil.Discard)
+	if got, err := ioutil.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Contains(got, []byte("wrong.ToUpper")) {
+		t.Fatalf("expected file to be rewritten, got:\n%s", got)
+	}
+
+	var buf bytes.Buffer
+	checkBuilds(ioutil.Discard, &buf)
+	if !strings.Contains(buf.String(), "build check failed for "+dir) {
+		t.Errorf("expected build failure to be reported, got:\n%s", buf.String())
+	}
+	if got, err := ioutil.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, src) {
+		t.Errorf("expected file to be restored, got:\n%s", got)
+	}
+	if modifiedDirs[dir] {
+		t.Error("expected restored directory to not be affected")
+	}
+	if exitCode != 1 {
+		t.Errorf("expected exit code 1, got: %d", exitCode)
+	}
+}
+
+// With -build-check, -print-changed prints only the files that remain
+// changed after the build check, and restored files don't count as changed.
+func TestBuildCheckPrintChanged(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The wrong mapping makes the rewrite of s.ToUpper in bad break the
+	// build; good builds.
+	files := map[string]string{
+		"go.mod": "module example.com/pkg\n",
+		"bad/bad.go": `package bad
+
+import (
+	"strings"
+	s "strings"
+)
+
+var _ = strings.ToLower("a")
+var _ = s.ToUpper("b")
+`,
+		"good/good.go": `package good
+
+import (
+	"bytes"
+	b "bytes"
+)
+
+var _ = bytes.ToLower(nil)
+var _ = b.ToUpper(nil)
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(path string) string {
+		resetFlags()
+		defer resetFlags()
+		*overwrite = true
+		*buildCheck = true
+		*printChg = true
+		mode = modeWrite
+		if err := pkgNames.Set("strings=wrong"); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { pkgNames.m = nil }()
+
+		var out bytes.Buffer
+		handleDir(token.NewFileSet(), path, &out)
+		if out.Len() != 0 {
+			t.Errorf("expected no output before the build check, got:\n%s", out.Bytes())
+		}
+		checkBuilds(&out, ioutil.Discard)
+		if got := anyChanged; got != (out.Len() != 0) {
+			t.Errorf("expected changed: %t, got: %t", out.Len() != 0, got)
+		}
+		return out.String()
+	}
+
+	if got, want := run(dir), filepath.Join(dir, "good", "good.go")+"\n"; got != want {
+		t.Errorf("expected output %q, got %q", want, got)
+	}
+	// bad was restored, so it can be handled again.
+	if got := run(filepath.Join(dir, "bad")); got != "" {
+		t.Errorf("expected no output, got %q", got)
+	}
+}
+
+func TestPattern(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	mode = modeList
+
+	src, err := ioutil.ReadFile("testdata/example.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.go", "sub/b.go", "testdata/c.go", "vendor/d.go", ".hidden/e.go", "_skip/f.go"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testcases := []struct {
+		vendor bool
+		want   []string
+	}{
+		{false, []string{"a.go", "sub/b.go"}},
+		{true, []string{"a.go", "sub/b.go", "vendor/d.go"}},
+	}
+	for _, tt := range testcases {
+		visited = make(map[string]bool)
+		*vendor = tt.vendor
+		var buf bytes.Buffer
+		handlePattern(token.NewFileSet(), dir+"/...", &buf)
+		var want string
+		for _, name := range tt.want {
+			want += filepath.Join(dir, filepath.FromSlash(name)) + "\n"
+		}
+		if buf.String() != want {
+			t.Errorf("vendor=%t: expected:\n%s\ngot:\n%s", tt.vendor, want, buf.String())
+		}
+	}
+
+	for _, arg := range []string{"...", "./...", "a/..."} {
+		if !isPattern(arg) {
+			t.Errorf("expected %s to be a pattern", arg)
+		}
+	}
+	for _, arg := range []string{".", "a...", "a/...b"} {
+		if isPattern(arg) {
+			t.Errorf("expected %s to not be a pattern", arg)
+		}
+	}
+}
+
+func TestResolveOutsideModule(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	*resolveNames = true
+	resolver = goListResolver{}
+	defer func() { resolver = goListResolver{} }()
+
+	// A directory without a go.mod, with an empty GOPATH, in which neither
+	// 'go list' nor go/build can find the package.
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	for k, v := range map[string]string{"GOPATH": filepath.Join(dir, "gopath"), "GO111MODULE": "", "GOFLAGS": "", "GOPROXY": "off"} {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+
+	src := []byte(`package main
+
+import (
+	"example.com/go-standalone"
+	s "example.com/go-standalone"
+)
+
+var _ = s.Run
+`)
+	filename := filepath.Join(dir, "main.go")
+	result, err := processFile(token.NewFileSet(), src, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(result.Output, []byte("standalone.Run")) {
+		t.Errorf("unexpected output:\n%s", result.Output)
+	}
+
+	var buf bytes.Buffer
+	if err := writeGuesses(&buf, token.NewFileSet(), src, filename); err != nil {
+		t.Fatal(err)
+	}
+	if want := `"example.com/go-standalone" -> standalone (guessed)`; !strings.Contains(buf.String(), want) {
+		t.Errorf("expected output to contain %s, got:\n%s", want, buf.String())
+	}
+}
+
+// Import paths are listed from the file's directory, so that they resolve in
+// the file's module rather than the current directory's.
+func TestResolveFileModule(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	resetFlags()
+	defer resetFlags()
+	*resolveNames = true
+	resolver = goListResolver{}
+	defer func() { resolver = goListResolver{} }()
+
+	dir, err := ioutil.TempDir("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"go.mod":             "module example.com/other\n",
+		"go-yaml.v3/yaml.go": "package goyaml\n",
+		"cmd/tool/main.go":   "package main\n",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for k, v := range map[string]string{"GOPATH": filepath.Join(dir, "gopath"), "GO111MODULE": "on", "GOFLAGS": "", "GOPROXY": "off"} {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+
+	src := []byte(`package main
+
+import (
+	"example.com/other/go-yaml.v3"
+	y "example.com/other/go-yaml.v3"
+)
+
+var _ = y.Marshal
+`)
+	result, err := processFile(token.NewFileSet(), src, filepath.Join(dir, "cmd", "tool", "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(result.Output, []byte("goyaml.Marshal")) {
+		t.Errorf("unexpected output:\n%s", result.Output)
+	}
+	if _, ok := resolver.resolve("example.com/other/go-yaml.v3", "."); ok {
+		t.Error("expected package to not resolve outside its module")
+	}
+}
+
+func TestReadFileList(t *testing.T) {
+	f, err := ioutil.TempFile("", "dedupimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	list := "a.go\r\n\nREADME.md\n  dir/b.go  \ndir\nc.go"
+	if _, err := f.WriteString(list); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	got, err := readFileList(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.go", "dir/b.go", "c.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected: %v, got: %v", want, got)
+	}
+
+	if _, err := readFileList(f.Name() + "-does-not-exist"); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
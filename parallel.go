@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"go/token"
+	"io/ioutil"
+	"sync"
+
+	"github.com/nishanths/dedupimport/dedup"
+)
+
+// prefetcher processes the files in a directory tree concurrently, ahead of
+// handleFile, which handles the files one at a time in path order and uses
+// the results. Only the processing is concurrent: printing, writing files,
+// and the rest of handleFile's work, including setting the exit code, happen
+// in handleFile, so the output is the same as without the prefetcher.
+type prefetcher struct {
+	fset  *token.FileSet
+	slots chan struct{} // bounds the number of results held at once
+
+	mu      sync.Mutex
+	pending map[string]*prefetch // by filename
+}
+
+// prefetch is the result of processing a file.
+type prefetch struct {
+	filename string
+	done     chan struct{} // closed when the fields below are set
+	src      []byte
+	result   *dedup.Result
+	err      error
+}
+
+// prefetched is the prefetcher for the directory being handled, or nil.
+var prefetched *prefetcher
+
+// startPrefetch starts processing the files with n goroutines. The results
+// are held until they are released, with at most a few per goroutine held at
+// once, so release must be called for each file in order. The files must
+// already have been checked with checkSkip, and skipped files left out.
+func startPrefetch(fset *token.FileSet, filenames []string, n int) *prefetcher {
+	p := &prefetcher{
+		fset:    fset,
+		slots:   make(chan struct{}, 2*n),
+		pending: make(map[string]*prefetch),
+	}
+	jobs := make([]*prefetch, len(filenames))
+	for i, f := range filenames {
+		jobs[i] = &prefetch{filename: f, done: make(chan struct{})}
+		p.pending[f] = jobs[i]
+	}
+
+	queue := make(chan *prefetch)
+	go func() {
+		// Slots are taken in order, so that the results for the files
+		// handleFile needs next are never waiting for a slot.
+		for _, pf := range jobs {
+			p.slots <- struct{}{}
+			queue <- pf
+		}
+		close(queue)
+	}()
+	for i := 0; i < n; i++ {
+		go func() {
+			for pf := range queue {
+				p.process(pf)
+			}
+		}()
+	}
+	return p
+}
+
+func (p *prefetcher) process(pf *prefetch) {
+	defer close(pf.done)
+
+	src, err := ioutil.ReadFile(pf.filename)
+	if err != nil {
+		// handleFile reports the error when it reads the file.
+		return
+	}
+	pf.src = src
+	if !*generated && isGenerated(src) {
+		// handleFile skips the file.
+		return
+	}
+	pf.result, pf.err = processFile(p.fset, src, pf.filename)
+}
+
+// lookup returns the result of processing filename, waiting for it if
+// necessary, or nil if the file wasn't prefetched or has changed since. p may
+// be nil.
+func (p *prefetcher) lookup(src []byte, filename string) *prefetch {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	pf := p.pending[filename]
+	p.mu.Unlock()
+	if pf == nil {
+		return nil
+	}
+	<-pf.done
+	if pf.src == nil || !bytes.Equal(pf.src, src) {
+		return nil
+	}
+	return pf
+}
+
+// release discards the result for filename, making room for more. It does
+// nothing if the file wasn't prefetched.
+func (p *prefetcher) release(filename string) {
+	p.mu.Lock()
+	pf := p.pending[filename]
+	delete(p.pending, filename)
+	p.mu.Unlock()
+	if pf == nil {
+		return
+	}
+	<-pf.done
+	<-p.slots
+}
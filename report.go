@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/scanner"
+	"io"
+
+	"github.com/nishanths/dedupimport/dedup"
+)
+
+// fileReport is the findings for a file, shared by the report formats.
+type fileReport struct {
+	Filename string          `json:"filename"`
+	Changed  bool            `json:"changed"`
+	Removed  []removedImport `json:"removed"`
+	Errors   string          `json:"errors,omitempty"`
+	Warnings []string        `json:"warnings,omitempty"`
+}
+
+// removedImport describes a duplicate import in a fileReport.
+type removedImport struct {
+	Path       string `json:"path"`
+	Name       string `json:"name"` // empty if unnamed
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+	KeptName   string `json:"keptName"` // empty if unnamed
+	KeptLine   int    `json:"keptLine"`
+	KeptColumn int    `json:"keptColumn"`
+	Strategy   string `json:"strategy"` // what chose the kept import; see dedup.SpecInfo
+}
+
+// newFileReport returns the findings for the file. For stdin, filename is
+// the '-stdin-filename' name, or "<standard input>", so that stdin and files
+// are reported alike.
+func newFileReport(filename string, result *dedup.Result, err error) fileReport {
+	r := fileReport{Filename: filename, Removed: []removedImport{}}
+	if result != nil {
+		r.Changed = result.Changed
+		r.Warnings = result.Warnings
+		for _, s := range result.RemovedSpecs {
+			r.Removed = append(r.Removed, removedImport{
+				Path:       s.Path,
+				Name:       s.Name,
+				Line:       s.Position.Line,
+				Column:     s.Position.Column,
+				KeptName:   s.KeptName,
+				KeptLine:   s.KeptPosition.Line,
+				KeptColumn: s.KeptPosition.Column,
+				Strategy:   s.Strategy,
+			})
+		}
+	}
+	if err != nil {
+		var buf bytes.Buffer
+		scanner.PrintError(&buf, err)
+		r.Errors = buf.String()
+	}
+	return r
+}
+
+// jsonReporter writes the findings as an indented JSON array with an entry
+// for each file handled, in the order handled.
+type jsonReporter struct {
+	files []fileReport
+}
+
+func (j *jsonReporter) Record(w io.Writer, r fileReport) error {
+	j.files = append(j.files, r)
+	return nil
+}
+
+func (j *jsonReporter) Flush(w io.Writer) error {
+	files := j.files
+	if files == nil {
+		files = []fileReport{}
+	}
+	b, err := json.MarshalIndent(files, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
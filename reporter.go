@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Reporter writes a report, in some format, of the duplicate imports in the
+// files handled. The findings for each file are recorded as a fileReport,
+// which all formats share.
+type Reporter interface {
+	// Record records the findings for a file. Formats that can be streamed
+	// write them to w right away.
+	Record(w io.Writer, r fileReport) error
+	// Flush writes the rest of the report to w, after all files are
+	// handled.
+	Flush(w io.Writer) error
+}
+
+// reportFormats are the values of '-report-format', with the functions
+// making their Reporters.
+var reportFormats = map[string]func() Reporter{
+	"text":  func() Reporter { return textReporter{} },
+	"json":  func() Reporter { return &jsonReporter{} },
+	"junit": func() Reporter { return &junitReporter{} },
+	"sarif": func() Reporter { return &sarifReporter{} },
+}
+
+// reporter is the Reporter for the report printed instead of the results,
+// with '-diagnostics', '-json', or '-report-format'; nil if there is no such
+// report. junitFileReporter is the Reporter for the '-junit' file; nil if the
+// flag isn't set.
+var (
+	reporter          Reporter
+	junitFileReporter Reporter
+)
+
+// reportFormat returns the format of the report printed instead of the
+// results, or "" if there is no such report. '-json' is shorthand for
+// '-report-format json', and '-diagnostics' prints the report in the
+// '-report-format' format, text by default.
+func reportFormat() string {
+	switch {
+	case *jsonReport:
+		return "json"
+	case *diagnose || *reportFmt != "text":
+		return *reportFmt
+	default:
+		return ""
+	}
+}
+
+// setupReporters sets reporter and junitFileReporter from the flags.
+func setupReporters() {
+	reporter, junitFileReporter = nil, nil
+	if f := reportFormat(); f != "" {
+		reporter = reportFormats[f]()
+	}
+	if *junitFile != "" {
+		junitFileReporter = reportFormats["junit"]()
+	}
+}
+
+// textReporter writes a line for each removable duplicate import in the go
+// vet diagnostic format, "file:line:column: message", as files are handled.
+type textReporter struct{}
+
+func (textReporter) Record(w io.Writer, r fileReport) error {
+	for _, s := range r.Removed {
+		if _, err := fmt.Fprintf(w, "%s:%d:%d: duplicate import of %q; remove in favor of line %d\n",
+			r.Filename, s.Line, s.Column, s.Path, s.KeptLine); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (textReporter) Flush(w io.Writer) error { return nil }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// goListResolver resolves package names with 'go list', for '-resolve'. It
+// is a dedup.Options.Resolver. It runs 'go list' directly, as
+// golang.org/x/tools/go/packages does, rather than depending on that package.
+// Unlike the go/build lookup used otherwise, it resolves packages in modules,
+// including those only in the module cache.
+//
+// An import path is listed from the importing file's directory, so that it
+// is resolved in the file's module. The results are cached by directory and
+// import path, so that each package is listed once per directory. The lock
+// isn't held while 'go list' runs, so that files processed concurrently with
+// '-p' aren't serialized on it.
+type goListResolver struct {
+	mu    sync.Mutex
+	names map[goListKey]*goListName
+}
+
+type goListKey struct {
+	dir, importPath string
+}
+
+// goListName is a cached result of 'go list'.
+type goListName struct {
+	done chan struct{} // closed when name is set
+	name string        // "" if the package could not be listed
+}
+
+func (r *goListResolver) resolve(importPath, dir string) (string, bool) {
+	k := goListKey{dir, importPath}
+	r.mu.Lock()
+	n, ok := r.names[k]
+	if !ok {
+		n = &goListName{done: make(chan struct{})}
+		if r.names == nil {
+			r.names = make(map[goListKey]*goListName)
+		}
+		r.names[k] = n
+	}
+	r.mu.Unlock()
+
+	if ok {
+		<-n.done
+	} else {
+		n.name = goList(importPath, dir)
+		close(n.done)
+	}
+	return n.name, n.name != ""
+}
+
+// goList returns the name of the package with the import path, as reported
+// by 'go list' run in dir, or "" if the package can't be listed, such as when
+// the go command isn't available or the package isn't found.
+func goList(importPath, dir string) string {
+	cmd := exec.Command("go", "list", "-e", "-f", "{{if not .Error}}{{.Name}}{{end}}", "--", importPath)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
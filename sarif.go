@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// sarifReporter writes the findings as a SARIF 2.1.0 log, for code scanning
+// tools such as GitHub code scanning. Each removable duplicate import is a
+// result of the "duplicate-import" rule, located at the import, with a
+// related location at the import kept instead.
+type sarifReporter struct {
+	results []sarifResult
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	HelpURI          string       `json:"helpUri"`
+}
+
+// sarifRuleID is the ID of the only rule, for duplicate imports.
+const sarifRuleID = "duplicate-import"
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	RuleIndex        int             `json:"ruleIndex"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"` // set for related locations
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+// sarifArtifact returns the artifact location for the file. Relative paths
+// are relative to the %SRCROOT% base, as code scanning tools expect, and
+// absolute paths are file URIs.
+func sarifArtifact(filename string) sarifArtifactLocation {
+	u := url.URL{Path: filepath.ToSlash(filename)}
+	if filepath.IsAbs(filename) {
+		if !strings.HasPrefix(u.Path, "/") {
+			u.Path = "/" + u.Path // such as C:/dir on Windows
+		}
+		u.Scheme = "file"
+		return sarifArtifactLocation{URI: u.String()}
+	}
+	return sarifArtifactLocation{URI: u.String(), URIBaseID: "%SRCROOT%"}
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+}
+
+func (s *sarifReporter) Record(w io.Writer, r fileReport) error {
+	artifact := sarifArtifact(r.Filename)
+	for _, im := range r.Removed {
+		keptID := 1
+		s.results = append(s.results, sarifResult{
+			RuleID:  sarifRuleID,
+			Level:   "warning",
+			Message: sarifMessage{fmt.Sprintf("duplicate import of %q; remove in favor of [line %d](1)", im.Path, im.KeptLine)},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{artifact, sarifRegion{im.Line, im.Column}},
+			}},
+			RelatedLocations: []sarifLocation{{
+				ID:               &keptID,
+				PhysicalLocation: sarifPhysicalLocation{artifact, sarifRegion{im.KeptLine, im.KeptColumn}},
+				Message:          &sarifMessage{"kept import"},
+			}},
+		})
+	}
+	return nil
+}
+
+func (s *sarifReporter) Flush(w io.Writer) error {
+	results := s.results
+	if results == nil {
+		results = []sarifResult{}
+	}
+	b, err := json.MarshalIndent(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool: sarifTool{sarifDriver{
+				Name:           "dedupimport",
+				InformationURI: "https://github.com/nishanths/dedupimport",
+				Rules: []sarifRule{{
+					ID:               sarifRuleID,
+					Name:             "DuplicateImport",
+					ShortDescription: sarifMessage{"Import of a package that is already imported by the file under a different name"},
+					HelpURI:          "https://godoc.org/github.com/nishanths/dedupimport",
+				}},
+			}},
+			Results: results,
+		}},
+	}, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,16 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	sha "crypto/sha256"
+)
+
+type Digest [sha.Size]byte
+
+var blocks [2 * sha.BlockSize]byte
+
+func sum(b []byte) [sha256.Size]byte {
+	var buf [sha.Size]byte
+	_ = [...]int{sha.Size: 1}
+	return buf
+}
@@ -0,0 +1,16 @@
+package pkg
+
+import (
+	""
+	""
+	"."
+	d "."
+	"/"
+	s "/"
+	"strings"
+	str "strings"
+)
+
+var _ = d.X
+var _ = s.X
+var _ = str.Title
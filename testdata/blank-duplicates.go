@@ -0,0 +1,14 @@
+package pkg
+
+import (
+	_ "net/http/pprof"
+	"fmt"
+	_ "net/http/pprof" // second blank import
+	_ "expvar"
+	"expvar"
+)
+
+import _ "net/http/pprof"
+
+var _ = fmt.Println
+var _ = expvar.NewInt
@@ -0,0 +1,11 @@
+//dedupimport -collapse-redundant-blank
+
+package pkg
+
+// With -collapse-redundant-blank, only the named import is kept.
+import (
+	_ "x"
+	n "x"
+)
+
+var _ = n.F
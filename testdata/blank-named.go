@@ -0,0 +1,10 @@
+package pkg
+
+// Without -collapse-redundant-blank, a blank import is kept alongside a named
+// import of the same path.
+import (
+	_ "x"
+	n "x"
+)
+
+var _ = n.F
@@ -0,0 +1,10 @@
+package pkg
+
+import (
+	_ "strings"
+	"strings"
+	s "strings"
+)
+
+var _ = strings.Title
+var _ = s.ToLower
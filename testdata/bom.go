@@ -0,0 +1,8 @@
+﻿package pkg
+
+import (
+	"strings"
+	s "strings"
+)
+
+var _ = s.Title
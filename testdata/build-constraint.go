@@ -0,0 +1,10 @@
+//go:build linux
+
+package pkg
+
+import (
+	"strings"
+	s "strings"
+)
+
+var _ = s.Title
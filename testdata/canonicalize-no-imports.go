@@ -0,0 +1,3 @@
+//dedupimport -imports-only-parse -canonicalize example.com/m=v2
+
+package p
@@ -0,0 +1,14 @@
+//dedupimport -canonicalize example.com/foo=v2 -canonicalize example.com/foo/bar=v3
+
+package pkg
+
+import (
+	"example.com/foo/bar/baz"
+	"example.com/foo/bar/v3/baz"
+	"example.com/foo/qux"
+)
+
+func a() {
+	baz.F()
+	qux.G()
+}
@@ -0,0 +1,17 @@
+//dedupimport -canonicalize example.com/foo=v2
+
+package pkg
+
+import (
+	"example.com/foo"
+	foov2 "example.com/foo/v2"
+	foov3 "example.com/foo/v3"
+	"example.com/foo/v3/bar"
+)
+
+func a() {
+	foo.F()
+	foov2.G()
+	foov3.H()
+	bar.I()
+}
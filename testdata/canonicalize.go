@@ -0,0 +1,19 @@
+//dedupimport -canonicalize example.com/foo=v2
+
+package pkg
+
+import (
+	"example.com/foo"
+	foov2 "example.com/foo/v2"
+	"example.com/foo/bar"
+	"example.com/foo/v2/baz"
+	"example.com/foobar"
+)
+
+func a() {
+	foo.F()
+	foov2.G()
+	bar.H()
+	baz.I()
+	foobar.J()
+}
@@ -0,0 +1,17 @@
+package pkg
+
+// #include <stdlib.h>
+import "C"
+
+// #include <stdio.h>
+import "C"
+
+import (
+	"unsafe"
+	u "unsafe"
+)
+
+func free(p *C.char) {
+	C.free(u.Pointer(p))
+	_ = unsafe.Sizeof(p)
+}
@@ -0,0 +1,12 @@
+//dedupimport -collapse-redundant-blank
+
+package pkg
+
+import (
+	_ "fmt"
+	_ "strings"
+	"strings"
+	_ "net/http/pprof"
+)
+
+var _ = strings.Title
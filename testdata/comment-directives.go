@@ -0,0 +1,14 @@
+//dedupimport -keep comment -comment-ignore-directives
+
+package pkg
+
+import (
+	"strings"
+	s "strings"   //nolint
+	str "strings" //
+	st "strings"  // the preferred name.
+)
+
+var _ = strings.Title
+var _ = s.ToUpper
+var _ = str.ToLower
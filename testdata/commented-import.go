@@ -0,0 +1,11 @@
+package pkg
+
+import (
+	"fmt"
+	/*
+		fmt2 "fmt"
+	*/
+	// f "fmt"
+)
+
+var _ = fmt.Println
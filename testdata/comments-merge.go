@@ -0,0 +1,18 @@
+//dedupimport -comments merge
+
+package pkg
+
+import (
+	"os" // unrelated
+	// Doc for fmt.
+	"fmt" // fmt line
+	f "fmt" // f line
+	fm "fmt" /* fm line */
+	"strings"
+	s "strings" // s line
+)
+
+var _ = f.Println
+var _ = fm.Print
+var _ = s.Title
+var _ = os.Exit
@@ -0,0 +1,17 @@
+//dedupimport -treat-aliases-as-distinct
+
+package pkg
+
+import (
+	"fmt"
+	"fmt"
+	f "fmt"
+	f "fmt"
+	g "fmt"
+	"strings"
+)
+
+var _ = fmt.Println
+var _ = f.Println
+var _ = g.Println
+var _ = strings.Title
@@ -0,0 +1,16 @@
+package pkg
+
+import (
+	. "strings"
+	"strings"
+	. "strings" // second dot import
+	_ "expvar"
+	_ "expvar"
+	. "fmt"
+)
+
+import . "strings"
+
+var _ = ToLower
+var _ = strings.ToUpper
+var _ = Println
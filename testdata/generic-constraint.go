@@ -0,0 +1,25 @@
+package pkg
+
+import (
+	"golang.org/x/exp/constraints"
+	c "golang.org/x/exp/constraints"
+)
+
+func Max[T c.Ordered](a, b T) T {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+type Set[K c.Ordered, V interface{ c.Integer | ~string }] map[K]V
+
+func (s Set[K, V]) Keys() []K { return nil }
+
+var _ = Max[int]
+
+type Number interface {
+	c.Integer | c.Float
+}
+
+var _ constraints.Signed
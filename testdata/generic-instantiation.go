@@ -0,0 +1,20 @@
+package pkg
+
+import (
+	"example.org/container"
+	c "example.org/container"
+)
+
+var list c.List[int]
+
+type Cache[K comparable, V any] struct {
+	m c.Map[K, V]
+}
+
+func newPairs() *c.Pairs[int, string] {
+	return c.NewPairs[int, string]()
+}
+
+func first(l container.List[int]) int {
+	return c.First[int](l)
+}
@@ -0,0 +1,19 @@
+package pkg
+
+import (
+	"example.org/worker"
+	w "example.org/worker"
+)
+
+func run(ch chan int) {
+	go w.Start()
+	go func() {
+		defer w.Done()
+	}()
+	defer w.Stop(worker.Now())
+	select {
+	case ch <- w.Next():
+	case v := <-w.Results():
+		_ = v
+	}
+}
@@ -0,0 +1,10 @@
+package pkg
+
+import ()
+
+import (
+	"strings"
+	s "strings"
+)
+
+var _ = s.Title
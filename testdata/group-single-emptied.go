@@ -0,0 +1,11 @@
+package pkg
+
+import (
+	"strings"
+)
+
+import (
+	s "strings"
+)
+
+var _ = s.Title
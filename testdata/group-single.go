@@ -0,0 +1,7 @@
+package pkg
+
+import (
+	"fmt"
+)
+
+var _ = fmt.Println
@@ -0,0 +1,15 @@
+//dedupimport -comments merge
+
+package pkg
+
+// The comment between the import keyword and the paren is kept, and isn't
+// merged into the kept spec.
+import /* note */ (
+	"fmt"
+	f "fmt" // f line
+)
+
+func main() {
+	f.Println("hello")
+	fmt.Println("world")
+}
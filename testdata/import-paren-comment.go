@@ -0,0 +1,15 @@
+package pkg
+
+// The comment between the import keyword and the paren belongs to the
+// import declaration, not to any spec, so it is kept.
+import /* note */ (
+	"fmt"
+	f "fmt" // f line
+	"os"
+)
+
+func main() {
+	f.Println("hello")
+	fmt.Println("world")
+	os.Exit(0)
+}
@@ -0,0 +1,17 @@
+//dedupimport -imports-only-parse
+
+package pkg
+
+import (
+	"fmt"
+	"fmt"
+	"strings"
+	str "strings"
+)
+
+// a comment after the imports
+
+func f() {
+	fmt.Println(strings.Title("a")
+	str.ToLower(
+}
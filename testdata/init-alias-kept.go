@@ -0,0 +1,14 @@
+//dedupimport -keep named
+
+package pkg
+
+import (
+	"fmt"
+	init "fmt"
+)
+
+func f() {
+	fmt.Println("f")
+}
+
+func init() {}
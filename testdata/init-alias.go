@@ -0,0 +1,15 @@
+package pkg
+
+import (
+	"fmt"
+	init "fmt"
+)
+
+func init() {
+	init.Println("hello")
+	fmt.Println("world")
+}
+
+func f() {
+	init.Println("f")
+}
@@ -0,0 +1,18 @@
+//dedupimport -keep-doc-referenced
+
+package pkg
+
+import (
+	"strings"
+	s "strings"
+	"bytes"
+	b "bytes"
+)
+
+// Upper is like s.ToUpper.
+func Upper(x string) string { return s.ToUpper(x) }
+
+// Buffer wraps a buffer (not the same as ab.Buffer).
+type Buffer struct{ b.Buffer }
+
+var _ = strings.Title
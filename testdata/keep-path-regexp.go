@@ -0,0 +1,16 @@
+//dedupimport -canonicalize example.com/foo=v2 -keep-path-regexp /v2
+
+package pkg
+
+import (
+	"example.com/foo/bar"
+	barv2 "example.com/foo/v2/bar"
+	"example.com/foo/baz"
+	"example.com/foo/baz"
+)
+
+func a() {
+	bar.F()
+	barv2.G()
+	baz.H()
+}
@@ -0,0 +1,19 @@
+//dedupimport -keep named -keep-comment-from first -keep-slot last
+
+package pkg
+
+import (
+	"fmt"
+	// strings, for titles
+	str "strings"
+)
+
+import (
+	"os"
+	"strings" // TODO: remove
+)
+
+var _ = fmt.Println
+var _ = os.Exit
+var _ = str.Title
+var _ = strings.ToLower
@@ -0,0 +1,20 @@
+//dedupimport -keep last
+
+package pkg
+
+import (
+	"strings"
+	s "strings"
+	str "strings"
+	f "fmt"
+	"fmt"
+)
+
+var _ = strings.Title
+var _ = s.ToLower
+var _ = str.ToUpper
+var _ = f.Println
+
+func g() {
+	fmt.Println(strings.Repeat("a", 2))
+}
@@ -0,0 +1,11 @@
+package pkg
+
+import (
+	"strings"
+	str "strings"
+)
+
+var _ = strings.Title("a")
+var _ = str.ToLower("b")
+var _ = str.ToUpper("c")
+var _ = str.TrimSpace("d")
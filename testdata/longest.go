@@ -0,0 +1,23 @@
+//dedupimport -keep longest
+
+package pkg
+
+import (
+	"strings"
+	s "strings"
+	stringutil "strings"
+	strs "strings"
+	"fmt"
+	f "fmt"
+	fm "fmt"
+	ff "fmt"
+)
+
+var _ = strings.Title
+var _ = s.ToLower
+var _ = strs.ToUpper
+var _ = stringutil.Repeat
+var _ = fmt.Println
+var _ = f.Printf
+var _ = fm.Sprint
+var _ = ff.Sprintf
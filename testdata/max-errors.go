@@ -0,0 +1,17 @@
+//dedupimport -max-errors 2
+
+package pkg
+
+import (
+	"strings"
+	s "strings"
+)
+
+func a() {
+	strings := 1
+	_ = s.ToUpper("a")
+	_ = s.ToLower("b")
+	_ = s.TrimSpace("c")
+	_ = s.Title("d")
+	_ = strings
+}
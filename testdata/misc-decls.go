@@ -0,0 +1,38 @@
+package pkg
+
+// Go requires import declarations to come before all other declarations, so
+// the import blocks can't be interleaved with the declarations below.
+
+import "strings"
+
+import (
+	s "strings"
+)
+
+import "bytes"
+
+const c = "c"
+
+var v = s.ToUpper(c)
+
+type T struct {
+	b bytes.Buffer
+}
+
+func f() string { return strings.ToLower(c) }
+
+const (
+	c1 = iota
+	c2
+)
+
+func (t *T) g() string { return s.Title(t.b.String()) }
+
+var (
+	v1, v2 = 1, 2
+)
+
+type (
+	U int
+	V = U
+)
@@ -0,0 +1,14 @@
+//dedupimport -fix-name-collisions
+
+package pkg
+
+import (
+	"example.com/a/client"
+	"example.com/b/client"
+	"strings"
+	s "strings"
+)
+
+var _ = client.New
+var _ = strings.Title
+var _ = s.ToLower
@@ -0,0 +1,16 @@
+//dedupimport -fix-name-collisions
+
+package pkg
+
+import (
+	"example.com/a/client"
+	bclient "example.com/b/client"
+	"example.com/b/client"
+	"strings"
+	s "strings"
+)
+
+var _ = client.New
+var _ = bclient.Dial
+var _ = strings.Title
+var _ = s.ToLower
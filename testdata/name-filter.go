@@ -0,0 +1,18 @@
+//dedupimport -name-filter pb$
+
+package pkg
+
+import (
+	"example.com/api/userpb"
+	upb "example.com/api/userpb"
+	"example.com/api/orderpb"
+	opb "example.com/api/orderpb"
+	"strings"
+	str "strings"
+)
+
+var _ = upb.User{}
+var _ = userpb.Request{}
+var _ = opb.Order{}
+var _ = str.ToLower
+var _ = strings.Title
@@ -0,0 +1,16 @@
+//dedupimport -keep named
+
+package pkg
+
+import (
+	"example.com/x"
+	foo "example.com/x"
+	"math/rand"
+	r "math/rand"
+)
+
+func f() {
+	x.Bar()
+	foo.Baz()
+	_ = rand.Int() + r.Int()
+}
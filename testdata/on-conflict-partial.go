@@ -0,0 +1,17 @@
+//dedupimport -on-conflict partial
+
+package pkg
+
+import (
+	"fmt"
+	f "fmt"
+	"strings"
+	s "strings"
+)
+
+func a() {
+	strings := 1
+	_ = s.ToUpper("a")
+	_ = strings
+	f.Println(fmt.Sprint())
+}
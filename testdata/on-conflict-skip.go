@@ -0,0 +1,15 @@
+package pkg
+
+import (
+	"fmt"
+	f "fmt"
+	"strings"
+	s "strings"
+)
+
+func a() {
+	strings := 1
+	_ = s.ToUpper("a")
+	_ = strings
+	f.Println(fmt.Sprint())
+}
@@ -0,0 +1,15 @@
+//dedupimport -order-sentinel //keep-order
+
+package pkg
+
+//keep-order
+import (
+	"strings"
+	"bytes"
+	b "bytes"
+	"archive/zip"
+)
+
+var _ = b.Buffer{}
+var _ = strings.Title
+var _ = zip.Store
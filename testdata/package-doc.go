@@ -0,0 +1,13 @@
+// Package pkg does things.
+//
+// It has a doc comment.
+package pkg
+
+// Imported for strings.
+import (
+	s "strings" // s line
+)
+
+import "strings"
+
+var _ = s.Title
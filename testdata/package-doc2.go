@@ -0,0 +1,8 @@
+// Package pkg does things.
+package pkg
+import (
+	s "strings"
+)
+import "strings"
+
+var _ = s.Title
@@ -0,0 +1,10 @@
+package pkg
+
+import (
+	"strings"
+	str "strings"
+)
+
+var a = (str).ToUpper("a")
+var b = ((str)).ToLower("b")
+var c = strings.TrimSpace(" c ")
@@ -0,0 +1,14 @@
+//dedupimport -pin-marker keepme
+
+package pkg
+
+import (
+	"strings"
+	// keepme
+	str "strings"
+	s "strings" /* keepme */
+)
+
+var _ = strings.Title
+var _ = str.ToLower
+var _ = s.ToUpper
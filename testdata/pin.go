@@ -0,0 +1,13 @@
+//dedupimport -pin-marker keepme
+
+package pkg
+
+import (
+	"strings"
+	str "strings" // keepme: matches the upstream file
+	s "strings"
+)
+
+var _ = strings.Title
+var _ = str.ToLower
+var _ = s.ToUpper
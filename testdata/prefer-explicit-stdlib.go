@@ -0,0 +1,14 @@
+//dedupimport -prefer-explicit-on-conflict
+
+package pkg
+
+// The package name for "strings" isn't a guess,
+// so the unnamed import is kept as usual.
+
+import (
+	s "strings"
+	"strings"
+)
+
+var _ = s.Title
+var _ = strings.ToLower
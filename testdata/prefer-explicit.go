@@ -0,0 +1,13 @@
+//dedupimport -prefer-explicit-on-conflict
+
+package pkg
+
+import (
+	"example.com/fmt/v1"
+	f "example.com/fmt/v1"
+)
+
+func foo() {
+	fmt.Println("hello")
+	f.Sprint("world")
+}
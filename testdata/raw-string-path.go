@@ -0,0 +1,13 @@
+package pkg
+
+import (
+	`fmt`
+	f "fmt"
+	`strings`
+	"os"
+)
+
+var _ = f.Println
+var _ = fmt.Print
+var _ = strings.Title
+var _ = os.Exit
@@ -0,0 +1,14 @@
+//dedupimport -keep named
+
+package pkg
+
+import (
+	f "fmt"
+	fmt "fmt"
+	"strings"
+	strings "strings"
+)
+
+var _ = f.Println
+var _ = fmt.Sprint
+var _ = strings.Title
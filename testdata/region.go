@@ -0,0 +1,22 @@
+//dedupimport -region 190:262
+
+package pkg
+
+import (
+	"code.org/frontend"
+	fe "code.org/frontend"
+	"fmt"
+	f "fmt"
+)
+
+func outside() {
+	fmt.Println(frontend.Version)
+	f.Println("outside")
+}
+
+func inside(req fe.Request) {
+	f.Println("inside")
+	fmt.Println(req)
+}
+
+func outside2() {}
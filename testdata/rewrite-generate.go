@@ -0,0 +1,15 @@
+//dedupimport -rewrite-generate
+
+package pkg
+
+import (
+	"example.com/gen"
+	g "example.com/gen"
+)
+
+//go:generate mytool -type=g.Kind -out=g_kind.go
+//go:generate othertool gen.Kind lg.Kind
+
+// g.Kind in a regular comment is left alone.
+var _ g.Kind
+var _ gen.Kind
@@ -0,0 +1,20 @@
+package pkg
+
+import (
+	"strings"
+	s "strings"
+)
+
+func a(v string) string {
+	for strings := 0; strings < 2; strings++ {
+		v += "a"
+	}
+	switch strings := len(v); strings {
+	case 1:
+		v += "b"
+	}
+	if strings := len(v); strings > 2 {
+		return v
+	}
+	return s.ToUpper(v)
+}
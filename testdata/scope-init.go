@@ -0,0 +1,15 @@
+package pkg
+
+import (
+	"strings"
+	s "strings"
+)
+
+func a(v string) string {
+	if strings := len(v); strings > 0 {
+		v = s.Repeat(v, strings)
+	} else {
+		v = s.TrimSpace(v)
+	}
+	return s.ToUpper(v)
+}
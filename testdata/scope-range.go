@@ -0,0 +1,15 @@
+package pkg
+
+import (
+	"strings"
+	s "strings"
+)
+
+func a(m map[string]int) {
+	for strings, n := range m {
+		_ = s.Repeat(strings, n)
+	}
+	for k := range s.Fields("a b") {
+		_ = k
+	}
+}
@@ -0,0 +1,15 @@
+package pkg
+
+import (
+	"strings"
+	s "strings"
+)
+
+func a(ch chan string, done chan bool) string {
+	select {
+	case strings := <-ch:
+		return s.Repeat(strings, 2)
+	case <-done:
+		return s.ToUpper("done")
+	}
+}
@@ -0,0 +1,18 @@
+package pkg
+
+import (
+	s "strings"
+	"strings"
+)
+
+func a() {
+	s := s.ToUpper("x")
+	_ = s
+}
+
+func b() {
+	var s = s.ToLower("y")
+	_ = s
+}
+
+var _ = strings.Title
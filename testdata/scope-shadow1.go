@@ -0,0 +1,32 @@
+package pkg
+
+import (
+	"strings"
+	s "strings"
+)
+
+type titler struct {
+	Title func(string) string
+}
+
+func a() {
+	_ = s.ToUpper("a")
+}
+
+func b() {
+	s := titler{}
+	_ = s.Title
+	{
+		_ = s.Title
+	}
+}
+
+func c(s titler) {
+	_ = s.Title
+}
+
+func d() {
+	_ = s.ToLower("d")
+	var s titler
+	_ = s.Title
+}
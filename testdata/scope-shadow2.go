@@ -0,0 +1,17 @@
+package pkg
+
+import (
+	"strings"
+	s "strings"
+)
+
+func a() {
+	strings := 1
+	_ = s.ToUpper("a")
+	_ = strings
+}
+
+func b() {
+	s := struct{ N int }{}
+	_ = s.N
+}
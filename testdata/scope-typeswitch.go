@@ -0,0 +1,16 @@
+package pkg
+
+import (
+	"fmt"
+	f "fmt"
+)
+
+func a(v interface{}) {
+	switch fmt := v.(type) {
+	case f.Stringer:
+		_ = f.Sprint(fmt)
+	default:
+		_ = fmt
+	}
+	_ = f.Sprint(v)
+}
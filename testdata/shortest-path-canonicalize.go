@@ -0,0 +1,11 @@
+//dedupimport -keep shortest-path -canonicalize example.com/foo=v2
+
+package pkg
+
+import (
+	"example.com/foo/v2/bar"
+	b "example.com/foo/bar" // the canonical path
+)
+
+var _ = bar.X
+var _ = b.Y
@@ -0,0 +1,11 @@
+//dedupimport -keep shortest-path
+
+package pkg
+
+import (
+	str "strings"
+	"strings"
+)
+
+var _ = strings.Title
+var _ = str.ToLower
@@ -0,0 +1,8 @@
+package pkg
+
+import (
+	"example.com/mapped"
+	"example.com/go-yaml.v2"
+	y "example.com/go-yaml.v2"
+	"strings"
+)
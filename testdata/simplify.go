@@ -0,0 +1,21 @@
+//dedupimport -simplify
+
+package pkg
+
+import (
+	"strings"
+	s "strings"
+)
+
+type T struct{ X, Y int }
+
+var points = []T{T{1, 2}, T{3, 4}}
+var ptrs = map[string]*T{"a": &T{5, 6}}
+
+func f(b []byte) {
+	_ = b[1:len(b)]
+	for i, _ := range b {
+		_ = s.Repeat("x", i)
+	}
+	_ = strings.Title
+}
@@ -0,0 +1,13 @@
+//dedupimport -strict-strategy -keep comment
+
+package pkg
+
+import (
+	"strings"
+	s "strings"
+)
+
+import (
+	"bytes" // one
+	b "bytes" // two
+)
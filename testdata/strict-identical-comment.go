@@ -0,0 +1,16 @@
+//dedupimport -strict-strategy -keep comment
+
+package pkg
+
+import (
+	"fmt"
+	"fmt"
+)
+
+import (
+	s "strings" // one
+	s "strings" // two
+)
+
+var _ = fmt.Println
+var _ = s.ToUpper
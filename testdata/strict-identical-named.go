@@ -0,0 +1,10 @@
+//dedupimport -strict-strategy -keep named
+
+package pkg
+
+import (
+	"fmt"
+	"fmt"
+)
+
+var _ = fmt.Println
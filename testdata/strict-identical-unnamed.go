@@ -0,0 +1,10 @@
+//dedupimport -strict-strategy -keep unnamed
+
+package pkg
+
+import (
+	s "strings"
+	s "strings"
+)
+
+var _ = s.ToUpper
@@ -0,0 +1,19 @@
+//dedupimport -strict-strategy -keep least-churn
+
+package pkg
+
+import (
+	"strings"
+	str "strings"
+)
+
+import (
+	"bytes"
+	b "bytes"
+)
+
+var _ = strings.Title("a")
+var _ = str.ToLower("b")
+var _ = bytes.Title(nil)
+var _ = b.ToLower(nil)
+var _ = b.ToUpper(nil)
@@ -0,0 +1,15 @@
+//dedupimport -strict-strategy -keep named
+
+package pkg
+
+import (
+	"strings"
+	sa "strings"
+	sb "strings"
+	strs "strings"
+)
+
+import (
+	"bytes"
+	"bytes"
+)
@@ -0,0 +1,12 @@
+//dedupimport -strict-strategy -keep named
+
+package pkg
+
+import (
+	"strings"
+	s "strings"
+	strs "strings"
+)
+
+var _ = strings.Title
+var _ = strs.ToLower
@@ -0,0 +1,8 @@
+//dedupimport -strict-strategy -keep unnamed
+
+package pkg
+
+import (
+	s "strings"
+	str "strings"
+)
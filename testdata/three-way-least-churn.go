@@ -0,0 +1,19 @@
+//dedupimport -keep least-churn
+
+package pkg
+
+import (
+	foo "example.org/pkg"
+	"example.org/pkg"
+	bar "example.org/pkg" // the HTTP helpers
+)
+
+func a() {
+	foo.Get()
+	pkg.Get()
+	pkg.Put()
+	bar.Post()
+	bar.Post()
+	bar.Post()
+	bar.Post()
+}
@@ -0,0 +1,15 @@
+//dedupimport -use-spaces -tabwidth 4
+
+package pkg
+
+import (
+    "strings"
+    s "strings"
+)
+
+func f(b bool) string {
+    if b {
+        return s.Title("a")
+    }
+    return strings.ToLower("B")
+}